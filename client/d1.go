@@ -4,91 +4,297 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
 	"github.com/crosleyzack/cloudflare-d1-go/utils"
 )
 
+const (
+	// DefaultBaseURL is the root of the cloudflare v4 REST API
+	DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+	// DefaultUserAgent is sent with each request unless overridden with WithUserAgent
+	DefaultUserAgent = "cloudflare-d1-go"
+	// DefaultNameCacheTTL is how long database name lookups are cached unless overridden with WithNameCacheTTL
+	DefaultNameCacheTTL = 5 * time.Minute
+)
+
 type Client struct {
 	AccountID string
 	APIToken  string
+	// BaseURL is the root of the cloudflare API, without a trailing slash
+	BaseURL string
+	// UserAgent is sent with each request to the cloudflare API
+	UserAgent string
+	// HTTPClient is used for all requests to the cloudflare API
+	HTTPClient *http.Client
+	// Logger receives debug logs for each request, if not nil
+	Logger *slog.Logger
+	// ErrorOnFailure return an *utils.APIError instead of a response when success is false
+	ErrorOnFailure bool
+	// RetryPolicy controls retries of transient failures. If nil, requests are attempted once.
+	RetryPolicy *utils.RetryPolicy
+	// RateLimiter throttles requests to the cloudflare API, if not nil
+	RateLimiter *utils.RateLimiter
+
+	// NameCacheTTL how long a name->ID lookup is trusted before ListDB is consulted again
+	NameCacheTTL time.Duration
+
+	// mu guards nameIDs
+	mu sync.RWMutex
 	// track map of dbName->dbID to facilitate lookups by name
-	NameIDMap map[string]string
+	nameIDs map[string]nameCacheEntry
 }
 
 var _ cloudflared1.CloudflareD1 = (*Client)(nil)
 
+// Option configures optional settings on a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the http client used to communicate with cloudflare.
+// This allows configuring proxies, TLS roots, connection pools or test transports.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithBaseURL sets the root of the cloudflare API, such as a local fake server,
+// an egress proxy or a staging host.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with each request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithLogger sets a logger which receives debug logs for each request
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.Logger = logger
+	}
+}
+
+// WithErrorOnFailure return an *utils.APIError from every method when the cloudflare API
+// reports a failure, rather than a response with success set to false.
+func WithErrorOnFailure() Option {
+	return func(c *Client) {
+		c.ErrorOnFailure = true
+	}
+}
+
+// WithRetryPolicy sets how transient failures are retried. By default only idempotent
+// calls (GetDB, ListDB and read queries) are retried; set RetryWrites to retry everything.
+// Use a MaxAttempts of 1 to disable retries.
+func WithRetryPolicy(policy utils.RetryPolicy) Option {
+	return func(c *Client) {
+		c.RetryPolicy = &policy
+	}
+}
+
+// WithRateLimiter throttles requests to the cloudflare API using limiter.
+// Share one limiter between clients using the same account to respect account wide limits.
+func WithRateLimiter(limiter *utils.RateLimiter) Option {
+	return func(c *Client) {
+		c.RateLimiter = limiter
+	}
+}
+
+// WithNameCacheTTL sets how long database name to ID lookups are cached.
+// A TTL of zero disables caching.
+func WithNameCacheTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.NameCacheTTL = ttl
+	}
+}
+
 // NewClient creates a client for communicating with Cloudflare D1
-func NewClient(accountID, apiToken string) (*Client, error) {
+func NewClient(accountID, apiToken string, opts ...Option) (*Client, error) {
 	if accountID == "" || apiToken == "" {
 		return nil, errors.New("Invalid account ID and/or API Token")
 	}
-	return &Client{
-		AccountID: accountID,
-		APIToken:  apiToken,
-		NameIDMap: map[string]string{},
-	}, nil
+	c := &Client{
+		AccountID:    accountID,
+		APIToken:     apiToken,
+		BaseURL:      DefaultBaseURL,
+		UserAgent:    DefaultUserAgent,
+		HTTPClient:   http.DefaultClient,
+		NameCacheTTL: DefaultNameCacheTTL,
+		nameIDs:      map[string]nameCacheEntry{},
+	}
+	retry := utils.DefaultRetryPolicy
+	c.RetryPolicy = &retry
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+	return c, nil
+}
+
+// requestConfig settings for sending a request with this client.
+// idempotent marks requests which are safe to retry.
+func (c *Client) requestConfig(idempotent bool) utils.RequestConfig {
+	return utils.RequestConfig{
+		HTTPClient:     c.HTTPClient,
+		APIToken:       c.APIToken,
+		UserAgent:      c.UserAgent,
+		Logger:         c.Logger,
+		ErrorOnFailure: c.ErrorOnFailure,
+		Retry:          c.RetryPolicy,
+		Idempotent:     idempotent,
+		Limiter:        c.RateLimiter,
+	}
 }
 
 // CreateDB create a new database with the given name in the cloudflare account.
-func (c *Client) CreateDB(_ context.Context, dbName string) (*utils.APIResponse[cloudflared1.D1Database], error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database", c.AccountID)
+func (c *Client) CreateDB(ctx context.Context, dbName string) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	return c.CreateDBWithOptions(ctx, dbName, cloudflared1.CreateDBOptions{})
+}
+
+// CreateDBWithOptions create a new database with the given name in the cloudflare account,
+// placed according to the location hint and jurisdiction in opts.
+func (c *Client) CreateDBWithOptions(ctx context.Context, dbName string, opts cloudflared1.CreateDBOptions) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database", c.BaseURL, c.AccountID)
 	body := map[string]any{
 		"name": dbName,
 	}
-	res, err := utils.DoRequest[cloudflared1.D1Database]("POST", url, body, c.APIToken)
+	if opts.PrimaryLocationHint != "" {
+		body["primary_location_hint"] = opts.PrimaryLocationHint
+	}
+	if opts.Jurisdiction != "" {
+		body["jurisdiction"] = opts.Jurisdiction
+	}
+	res, err := utils.DoRequest[cloudflared1.D1Database](ctx, c.requestConfig(false), "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
-	c.NameIDMap[dbName] = res.Result.UUID.String()
+	if res.Success {
+		c.rememberID(dbName, res.Result.UUID.String())
+	}
 	return res, err
 }
 
 // DeleteDB delete a database by ID in the cloudflare account.
-func (c *Client) DeleteDB(_ context.Context, dbID string) (*utils.APIResponse[cloudflared1.DeleteResult], error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s", c.AccountID, dbID)
-	return utils.DoRequest[cloudflared1.DeleteResult]("DELETE", url, nil, c.APIToken)
+func (c *Client) DeleteDB(ctx context.Context, dbID string) (*utils.APIResponse[cloudflared1.DeleteResult], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s", c.BaseURL, c.AccountID, dbID)
+	res, err := utils.DoRequest[cloudflared1.DeleteResult](ctx, c.requestConfig(false), "DELETE", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.Success {
+		c.forgetID(dbID)
+	}
+	return res, nil
 }
 
 // UpdateDB update the database settings by ID in the cloudflare account.
-func (c *Client) UpdateDB(_ context.Context, dbID string, settings cloudflared1.DBSettings) (*utils.APIResponse[cloudflared1.D1Database], error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s", c.AccountID, dbID)
+func (c *Client) UpdateDB(ctx context.Context, dbID string, settings cloudflared1.DBSettings) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s", c.BaseURL, c.AccountID, dbID)
 	body := map[string]any{
 		"read_replication": map[string]any{
 			"mode": settings.Replication.String(),
 		},
 	}
-	return utils.DoRequest[cloudflared1.D1Database]("PATCH", url, body, c.APIToken)
+	return utils.DoRequest[cloudflared1.D1Database](ctx, c.requestConfig(false), "PATCH", url, body)
 }
 
 // GetDB retrieve information on a database by id in the cloudflare account.
-func (c *Client) GetDB(_ context.Context, dbID string) (*utils.APIResponse[cloudflared1.D1Database], error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s", c.AccountID, dbID)
-	return utils.DoRequest[cloudflared1.D1Database]("GET", url, nil, c.APIToken)
+func (c *Client) GetDB(ctx context.Context, dbID string) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s", c.BaseURL, c.AccountID, dbID)
+	return utils.DoRequest[cloudflared1.D1Database](ctx, c.requestConfig(true), "GET", url, nil)
 }
 
-// ListDB list all databases in the cloudflare account.
-func (c *Client) ListDB(_ context.Context) (*utils.APIResponse[cloudflared1.D1DatabaseList], error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database", c.AccountID)
-	return utils.DoRequest[cloudflared1.D1DatabaseList]("GET", url, nil, c.APIToken)
+// ListDB list databases in the cloudflare account, optionally filtered by name and paginated.
+func (c *Client) ListDB(ctx context.Context, opts ...cloudflared1.ListDBOption) (*utils.APIResponse[cloudflared1.D1DatabaseList], error) {
+	o := cloudflared1.NewListDBOptions(opts...)
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(o.Page))
+	query.Set("per_page", strconv.Itoa(o.PerPage))
+	if o.Name != "" {
+		query.Set("name", o.Name)
+	}
+	url := fmt.Sprintf("%s/accounts/%s/d1/database?%s", c.BaseURL, c.AccountID, query.Encode())
+	return utils.DoRequest[cloudflared1.D1DatabaseList](ctx, c.requestConfig(true), "GET", url, nil)
+}
+
+// encodeParams encode query parameters the way D1 expects them. Blobs are sent as arrays of
+// numbers, as encoding/json would otherwise send []byte as base64 text.
+func encodeParams(params []any) []any {
+	if params == nil {
+		return nil
+	}
+	out := make([]any, len(params))
+	for i, p := range params {
+		b, ok := p.([]byte)
+		if !ok {
+			out[i] = p
+			continue
+		}
+		blob := make([]int, len(b))
+		for j, c := range b {
+			blob[j] = int(c)
+		}
+		out[i] = blob
+	}
+	return out
 }
 
 // QueryDB execute a SQL query on the D1 database with parameters
-func (c *Client) QueryDB(_ context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s/query", c.AccountID, dbID)
+func (c *Client) QueryDB(ctx context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/query", c.BaseURL, c.AccountID, dbID)
 	body := map[string]any{
 		"sql":    query,
-		"params": params,
+		"params": encodeParams(params),
 	}
-	return utils.DoRequest[[]cloudflared1.QueryResult[any]]("POST", url, body, c.APIToken)
+	return utils.DoRequest[[]cloudflared1.QueryResult[any]](ctx, c.requestConfig(isReadOnly(query)), "POST", url, body)
 }
 
-// QueryDBRaw execute a SQL query on the D1 database with parameters
-func (c *Client) QueryDBRaw(_ context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s/raw", c.AccountID, dbID)
+// QueryDBRaw execute a SQL query on the D1 database with parameters, returning rows as arrays
+func (c *Client) QueryDBRaw(ctx context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.RawResult], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/raw", c.BaseURL, c.AccountID, dbID)
 	body := map[string]any{
 		"sql":    query,
-		"params": params,
+		"params": encodeParams(params),
+	}
+	return utils.DoRequest[[]cloudflared1.RawResult](ctx, c.requestConfig(isReadOnly(query)), "POST", url, body)
+}
+
+// BatchQuery execute multiple SQL statements on the D1 database atomically in a single request
+func (c *Client) BatchQuery(ctx context.Context, dbID string, statements []cloudflared1.Statement) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/query", c.BaseURL, c.AccountID, dbID)
+	body, readOnly := batchBody(statements)
+	return utils.DoRequest[[]cloudflared1.QueryResult[any]](ctx, c.requestConfig(readOnly), "POST", url, body)
+}
+
+// BatchQueryRaw execute multiple SQL statements on the D1 database atomically in a single request,
+// returning rows as arrays
+func (c *Client) BatchQueryRaw(ctx context.Context, dbID string, statements []cloudflared1.Statement) (*utils.APIResponse[[]cloudflared1.RawResult], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/raw", c.BaseURL, c.AccountID, dbID)
+	body, readOnly := batchBody(statements)
+	return utils.DoRequest[[]cloudflared1.RawResult](ctx, c.requestConfig(readOnly), "POST", url, body)
+}
+
+// batchBody request body of a batch, and whether every statement in it is read only
+func batchBody(statements []cloudflared1.Statement) (map[string]any, bool) {
+	batch := make([]cloudflared1.Statement, len(statements))
+	readOnly := true
+	for i, stmt := range statements {
+		batch[i] = cloudflared1.Statement{SQL: stmt.SQL, Params: encodeParams(stmt.Params)}
+		readOnly = readOnly && isReadOnly(stmt.SQL)
 	}
-	return utils.DoRequest[[]cloudflared1.QueryResult[any]]("POST", url, body, c.APIToken)
+	return map[string]any{"batch": batch}, readOnly
 }
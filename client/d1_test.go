@@ -44,14 +44,16 @@ func TestCreateDeleteUpdateDB(t *testing.T) {
 	assert.True(t, createResult.Success)
 	assert.Equal(t, newDBName, createResult.Result.Name)
 	dbID := createResult.Result.UUID
-	assert.Equal(t, dbID.String(), client.NameIDMap[newDBName])
+	lookupID, ok := client.LookupID(newDBName)
+	assert.True(t, ok)
+	assert.Equal(t, dbID.String(), lookupID)
 
 	if !createResult.Success {
 		panic("Test cannot continue, db creation failed")
 	}
 
 	// get db
-	getResult, err := client.GetDB(ctx, newDBName)
+	getResult, err := client.GetDBByName(ctx, newDBName)
 	assert.NoError(t, err)
 	assert.NotNil(t, getResult)
 	assert.Len(t, getResult.Errors, 0)
@@ -98,7 +100,9 @@ func TestEditDBRecords(t *testing.T) {
 	assert.True(t, createResult.Success)
 	assert.Equal(t, newDBName, createResult.Result.Name)
 	dbID := createResult.Result.UUID
-	assert.Equal(t, dbID.String(), client.NameIDMap[newDBName])
+	lookupID, ok := client.LookupID(newDBName)
+	assert.True(t, ok)
+	assert.Equal(t, dbID.String(), lookupID)
 
 	if !createResult.Success {
 		panic("Test cannot continue, db creation failed")
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+var _ cloudflared1.Exporter = (*Client)(nil)
+
+// Export dump a database by id as SQL and stream it to w.
+// The export is started, polled every opts.PollInterval until cloudflare reports it complete,
+// then downloaded from the signed URL in the result.
+func (c *Client) Export(ctx context.Context, dbID string, w io.Writer, opts cloudflared1.ExportOptions) (*utils.APIResponse[cloudflared1.ExportOperation], error) {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = cloudflared1.DefaultPollInterval
+	}
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/export", c.BaseURL, c.AccountID, dbID)
+	body := map[string]any{
+		"output_format": "polling",
+		"dump_options":  opts,
+	}
+	// starting an export is not retried, but polling one is
+	idempotent := false
+	for {
+		res, err := utils.DoRequest[cloudflared1.ExportOperation](ctx, c.requestConfig(idempotent), "POST", url, body)
+		if err != nil {
+			return nil, err
+		}
+		if err := res.Err(); err != nil {
+			return res, err
+		}
+		switch res.Result.Status {
+		case cloudflared1.OperationComplete:
+			if res.Result.Result == nil || res.Result.Result.SignedURL == "" {
+				return res, errors.New("d1: export completed without a download url")
+			}
+			return res, c.download(ctx, res.Result.Result.SignedURL, w, opts.Progress)
+		case cloudflared1.OperationError:
+			return res, fmt.Errorf("d1: export failed: %s", res.Result.Error)
+		}
+		body["current_bookmark"] = res.Result.AtBookmark
+		idempotent = true
+		if err := utils.Sleep(ctx, interval); err != nil {
+			return res, err
+		}
+	}
+}
+
+// download stream the file at a signed url to w
+func (c *Client) download(ctx context.Context, signedURL string, w io.Writer, progress utils.ProgressFunc) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", signedURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("d1: download failed with status %d", resp.StatusCode)
+	}
+	_, err = io.Copy(w, utils.NewProgressReader(resp.Body, resp.ContentLength, progress))
+	return err
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+var _ cloudflared1.Importer = (*Client)(nil)
+
+// ImportSQL execute the SQL file read from r against a database by id.
+// The file is uploaded to a signed URL, ingested, then polled every opts.PollInterval until
+// cloudflare reports the import complete. If r is an io.ReadSeeker it is read twice,
+// otherwise it is buffered in memory to compute its checksum.
+func (c *Client) ImportSQL(ctx context.Context, dbID string, r io.Reader, opts cloudflared1.ImportOptions) (*utils.APIResponse[cloudflared1.ImportOperation], error) {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = cloudflared1.DefaultPollInterval
+	}
+	file, size, etag, err := checksum(r)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/import", c.BaseURL, c.AccountID, dbID)
+
+	res, err := c.importStep(ctx, url, true, map[string]any{
+		"action": "init",
+		"etag":   etag,
+	})
+	if err != nil {
+		return res, err
+	}
+	if res.Result.UploadURL == "" {
+		return res, errors.New("d1: import did not return an upload url")
+	}
+	if err := c.upload(ctx, res.Result.UploadURL, file, size, etag, opts.Progress); err != nil {
+		return res, err
+	}
+
+	res, err = c.importStep(ctx, url, false, map[string]any{
+		"action":   "ingest",
+		"etag":     etag,
+		"filename": res.Result.Filename,
+	})
+	for err == nil && res.Result.Status != cloudflared1.OperationComplete {
+		if err := utils.Sleep(ctx, interval); err != nil {
+			return res, err
+		}
+		res, err = c.importStep(ctx, url, true, map[string]any{
+			"action":           "poll",
+			"current_bookmark": res.Result.AtBookmark,
+		})
+	}
+	return res, err
+}
+
+// importStep send one request of the import flow, returning an error if it failed
+func (c *Client) importStep(ctx context.Context, url string, idempotent bool, body map[string]any) (*utils.APIResponse[cloudflared1.ImportOperation], error) {
+	res, err := utils.DoRequest[cloudflared1.ImportOperation](ctx, c.requestConfig(idempotent), "POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return res, err
+	}
+	if res.Result.Status == cloudflared1.OperationError {
+		return res, fmt.Errorf("d1: import failed: %s", res.Result.Error)
+	}
+	return res, nil
+}
+
+// upload send the SQL file to a signed url, checking the stored object matches etag
+func (c *Client) upload(ctx context.Context, signedURL string, file io.Reader, size int64, etag string, progress utils.ProgressFunc) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", signedURL, utils.NewProgressReader(file, size, progress))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("d1: upload failed with status %d", resp.StatusCode)
+	}
+	if got := strings.Trim(resp.Header.Get("ETag"), `"`); got != "" && got != etag {
+		return fmt.Errorf("d1: upload checksum mismatch, expected %s but got %s", etag, got)
+	}
+	return nil
+}
+
+// checksum return the md5 of r as hex, along with its size and a reader positioned at its start
+func checksum(r io.Reader) (io.Reader, int64, string, error) {
+	hash := md5.New()
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		size, err := io.Copy(hash, rs)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, 0, "", err
+		}
+		return rs, size, hex.EncodeToString(hash.Sum(nil)), nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	hash.Write(data)
+	return bytes.NewReader(data), int64(len(data)), hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"strings"
+	"unicode"
+)
+
+// writeKeywords statements which modify the database when they appear inside a WITH query
+var writeKeywords = map[string]bool{
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+}
+
+// isReadOnly conservatively check whether a query only reads data, making it safe to retry.
+// Anything which cannot be classified with certainty, such as multiple statements, is treated as a write.
+func isReadOnly(query string) bool {
+	query = strings.TrimRightFunc(stripComments(query), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ';'
+	})
+	if strings.Contains(query, ";") {
+		return false
+	}
+	words := strings.FieldsFunc(strings.ToUpper(query), func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+	})
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "SELECT", "VALUES", "EXPLAIN":
+		return true
+	case "WITH":
+		for _, word := range words {
+			if writeKeywords[word] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// stripComments remove leading "--" and "/* */" comments and whitespace from a query
+func stripComments(query string) string {
+	for {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		switch {
+		case strings.HasPrefix(query, "--"):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		default:
+			return query
+		}
+	}
+}
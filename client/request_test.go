@@ -0,0 +1,567 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// rewriteTransport sends every request to the test server instead of cloudflare
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (r *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = r.target.Scheme
+	req.URL.Host = r.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newRewriteClient(t *testing.T, server *httptest.Server) *http.Client {
+	target, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	return &http.Client{Transport: &rewriteTransport{target: target}}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "/client/v4/accounts/account/d1/database/db-id", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result":{"name":"test-db"},"success":true,"errors":[],"messages":[]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient("account", "token", WithHTTPClient(newRewriteClient(t, server)))
+	assert.NoError(t, err)
+	res, err := client.GetDB(context.Background(), "db-id")
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Equal(t, "test-db", res.Result.Name)
+}
+
+func TestContextCancellation(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewClient("account", "token", WithHTTPClient(newRewriteClient(t, server)))
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.ListDB(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// newTestClient creates a client which sends all requests to a test server running handler
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := NewClient("account", "token", append([]Option{WithBaseURL(server.URL + "/")}, opts...)...)
+	assert.NoError(t, err)
+	return client
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	client, err := NewClient("account", "token")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultBaseURL, client.BaseURL)
+	assert.Equal(t, DefaultUserAgent, client.UserAgent)
+	assert.Equal(t, http.DefaultClient, client.HTTPClient)
+	assert.Nil(t, client.Logger)
+}
+
+func TestWithBaseURLAndUserAgent(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/accounts/account/d1/database/db-id/query", r.URL.Path)
+		assert.Equal(t, "my-agent/1.0", r.Header.Get("User-Agent"))
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "SELECT ?", body["sql"])
+		assert.Equal(t, []any{float64(1)}, body["params"])
+		w.Write([]byte(`{"result":[{"results":[{"?":1}],"success":true,"meta":{"changes":0}}],"success":true,"errors":[],"messages":[]}`))
+	}, WithUserAgent("my-agent/1.0"))
+
+	res, err := client.QueryDB(context.Background(), "db-id", "SELECT ?", 1)
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Len(t, res.Result, 1)
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":[],"success":true,"errors":[],"messages":[]}`))
+	}, WithLogger(logger))
+
+	_, err := client.ListDB(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "method=GET")
+	assert.Contains(t, buf.String(), "status=200")
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	var attempts atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("<html>unavailable</html>"))
+			return
+		}
+		w.Write([]byte(`{"result":{"name":"test-db"},"success":true,"errors":[],"messages":[]}`))
+	}, WithRetryPolicy(utils.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	res, err := client.GetDB(context.Background(), "db-id")
+	assert.NoError(t, err)
+	assert.Equal(t, "test-db", res.Result.Name)
+	assert.EqualValues(t, 3, attempts.Load())
+}
+
+func TestRetryWrites(t *testing.T) {
+	var attempts atomic.Int32
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"result":null,"success":false,"errors":[{"code":971,"message":"Please wait"}],"messages":[]}`))
+	}
+	policy := utils.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	// writes are not retried by default
+	client := newTestClient(t, handler, WithRetryPolicy(policy))
+	res, err := client.QueryDB(context.Background(), "db-id", "INSERT INTO t VALUES (1)")
+	assert.NoError(t, err)
+	assert.False(t, res.Success)
+	assert.EqualValues(t, 1, attempts.Load())
+
+	// reads are
+	attempts.Store(0)
+	res, err = client.QueryDB(context.Background(), "db-id", "SELECT * FROM t")
+	assert.NoError(t, err)
+	assert.False(t, res.Success)
+	assert.EqualValues(t, 3, attempts.Load())
+
+	// writes are retried when opted in
+	attempts.Store(0)
+	policy.RetryWrites = true
+	client = newTestClient(t, handler, WithRetryPolicy(policy), WithErrorOnFailure())
+	_, err = client.QueryDB(context.Background(), "db-id", "INSERT INTO t VALUES (1)")
+	assert.ErrorIs(t, err, utils.ErrRateLimited)
+	assert.EqualValues(t, 3, attempts.Load())
+}
+
+func TestIsReadOnly(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT * FROM users":                              true,
+		"  -- comment\n/* block */ select 1;":              true,
+		"WITH x AS (SELECT 1) SELECT * FROM x":             true,
+		"WITH x AS (SELECT 1) DELETE FROM t WHERE id IN x": false,
+		"INSERT INTO t SELECT * FROM s":                    false,
+		"SELECT 1; DELETE FROM t":                          false,
+		"PRAGMA table_info(t)":                             false,
+		"":                                                 false,
+	}
+	for query, expected := range tests {
+		assert.Equal(t, expected, isReadOnly(query), query)
+	}
+}
+
+func TestBatchQuery(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/accounts/account/d1/database/db-id/query", r.URL.Path)
+		var body struct {
+			Batch []cloudflared1.Statement `json:"batch"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Len(t, body.Batch, 2)
+		assert.Equal(t, "INSERT INTO t VALUES (?)", body.Batch[0].SQL)
+		assert.Equal(t, []any{"a"}, body.Batch[0].Params)
+		w.Write([]byte(`{"result":[{"results":[],"success":true,"meta":{"changes":1}},{"results":[],"success":true,"meta":{"changes":1}}],"success":true,"errors":[],"messages":[]}`))
+	})
+
+	res, err := client.BatchQuery(context.Background(), "db-id", []cloudflared1.Statement{
+		{SQL: "INSERT INTO t VALUES (?)", Params: []any{"a"}},
+		{SQL: "INSERT INTO t VALUES (?)", Params: []any{"b"}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Len(t, res.Result, 2)
+	assert.Equal(t, 1, res.Result[1].Meta.Changes)
+}
+
+func TestBatchQueryRaw(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/accounts/account/d1/database/db-id/raw", r.URL.Path)
+		var body struct {
+			Batch []cloudflared1.Statement `json:"batch"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Len(t, body.Batch, 2)
+		w.Write([]byte(`{"result":[{"results":{"columns":[],"rows":[]},"success":true,"meta":{"changes":1}},{"results":{"columns":["n"],"rows":[[1]]},"success":true,"meta":{}}],"success":true,"errors":[],"messages":[]}`))
+	})
+
+	res, err := client.BatchQueryRaw(context.Background(), "db-id", []cloudflared1.Statement{
+		{SQL: "INSERT INTO t VALUES (?)", Params: []any{"a"}},
+		{SQL: "SELECT count(*) AS n FROM t"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Len(t, res.Result, 2)
+	assert.Equal(t, 1, res.Result[0].Meta.Changes)
+	assert.Equal(t, [][]any{{float64(1)}}, res.Result[1].Rows)
+}
+
+func TestQueryDBRaw(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/accounts/account/d1/database/db-id/raw", r.URL.Path)
+		w.Write([]byte(`{"result":[{"results":{"columns":["id","name","name"],"rows":[[1,"a","b"],[2,"c","d"]]},"success":true,"meta":{"rows_read":2}}],"success":true,"errors":[],"messages":[]}`))
+	})
+
+	res, err := client.QueryDBRaw(context.Background(), "db-id", "SELECT a.id, a.name, b.name FROM a JOIN b")
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Len(t, res.Result, 1)
+	raw := res.Result[0]
+	assert.True(t, raw.Success)
+	assert.Equal(t, []string{"id", "name", "name"}, raw.Columns)
+	assert.Equal(t, [][]any{{float64(1), "a", "b"}, {float64(2), "c", "d"}}, raw.Rows)
+	assert.Equal(t, 2, raw.Meta.RowsRead)
+
+	// encoding matches the wire format
+	out, err := json.Marshal(raw)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"results":{"columns":["id","name","name"],"rows":[[1,"a","b"],[2,"c","d"]]}`)
+}
+
+func TestConcurrentUse(t *testing.T) {
+	var mu sync.Mutex
+	created := 0
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			if strings.HasSuffix(r.URL.Path, "/query") {
+				w.Write([]byte(`{"result":[{"results":[],"success":true,"meta":{}}],"success":true,"errors":[],"messages":[]}`))
+				return
+			}
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			created++
+			id := fmt.Sprintf("00000000-0000-0000-0000-%012d", created)
+			mu.Unlock()
+			fmt.Fprintf(w, `{"result":{"name":%q,"uuid":%q},"success":true,"errors":[],"messages":[]}`, body["name"], id)
+		case "DELETE":
+			w.Write([]byte(`{"result":{},"success":true,"errors":[],"messages":[]}`))
+		}
+	})
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("db-%d", i)
+			res, err := client.CreateDB(ctx, name)
+			if !assert.NoError(t, err) {
+				return
+			}
+			id, ok := client.LookupID(name)
+			assert.True(t, ok)
+			assert.Equal(t, res.Result.UUID.String(), id)
+			_, err = client.QueryDB(ctx, id, "SELECT 1")
+			assert.NoError(t, err)
+			_, err = client.DeleteDB(ctx, id)
+			assert.NoError(t, err)
+			_, ok = client.LookupID(name)
+			assert.False(t, ok)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestResolveID(t *testing.T) {
+	const dbID = "11111111-2222-3333-4444-555555555555"
+	var lists atomic.Int32
+	deleted := false
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/accounts/account/d1/database":
+			lists.Add(1)
+			assert.Equal(t, "orders", r.URL.Query().Get("name"))
+			if deleted {
+				w.Write([]byte(`{"result":[],"success":true,"errors":[],"messages":[]}`))
+				return
+			}
+			fmt.Fprintf(w, `{"result":[{"name":"orders-archive","uuid":"00000000-0000-0000-0000-000000000000"},{"name":"orders","uuid":%q}],"success":true,"errors":[],"messages":[]}`, dbID)
+		case r.Method == "GET":
+			fmt.Fprintf(w, `{"result":{"name":"orders","uuid":%q},"success":true,"errors":[],"messages":[]}`, dbID)
+		case r.Method == "DELETE":
+			deleted = true
+			w.Write([]byte(`{"result":{},"success":true,"errors":[],"messages":[]}`))
+		}
+	})
+	ctx := context.Background()
+
+	// ids are returned as is
+	id, err := client.ResolveID(ctx, dbID)
+	assert.NoError(t, err)
+	assert.Equal(t, dbID, id)
+	assert.EqualValues(t, 0, lists.Load())
+
+	// names fall back to ListDB, then are cached
+	id, err = client.ResolveID(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, dbID, id)
+	res, err := client.GetDBByName(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", res.Result.Name)
+	assert.EqualValues(t, 1, lists.Load())
+
+	// deleting invalidates the cache
+	_, err = client.DeleteDB(ctx, dbID)
+	assert.NoError(t, err)
+	_, ok := client.LookupID("orders")
+	assert.False(t, ok)
+	_, err = client.ResolveID(ctx, "orders")
+	assert.ErrorIs(t, err, utils.ErrNotFound)
+	assert.EqualValues(t, 2, lists.Load())
+}
+
+func TestNameCacheTTL(t *testing.T) {
+	var lists atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		lists.Add(1)
+		w.Write([]byte(`{"result":[{"name":"orders","uuid":"11111111-2222-3333-4444-555555555555"}],"success":true,"errors":[],"messages":[]}`))
+	}, WithNameCacheTTL(20*time.Millisecond))
+	ctx := context.Background()
+
+	_, err := client.ResolveID(ctx, "orders")
+	assert.NoError(t, err)
+	_, err = client.ResolveID(ctx, "orders")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, lists.Load())
+
+	// expired entries are refreshed
+	time.Sleep(30 * time.Millisecond)
+	_, err = client.ResolveID(ctx, "orders")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, lists.Load())
+}
+
+func TestListDBOptions(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/accounts/account/d1/database", r.URL.Path)
+		assert.Equal(t, "orders", r.URL.Query().Get("name"))
+		assert.Equal(t, "3", r.URL.Query().Get("page"))
+		assert.Equal(t, "25", r.URL.Query().Get("per_page"))
+		w.Write([]byte(`{"result":[{"name":"orders"}],"result_info":{"page":3,"per_page":25,"count":1,"total_count":51},"success":true,"errors":[],"messages":[]}`))
+	})
+
+	res, err := client.ListDB(context.Background(), cloudflared1.ListByName("orders"), cloudflared1.ListPage(3), cloudflared1.ListPerPage(25))
+	assert.NoError(t, err)
+	assert.Len(t, res.Result, 1)
+	assert.Equal(t, &utils.ResultInfo{Page: 3, PerPage: 25, Count: 1, TotalCount: 51}, res.ResultInfo)
+}
+
+func TestCreateDBWithOptions(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]any{
+			"name":                  "orders",
+			"primary_location_hint": "weur",
+			"jurisdiction":          "eu",
+		}, body)
+		w.Write([]byte(`{"result":{"name":"orders","uuid":"7b2c2b4e-8d1a-4a8e-9c61-3f2f0b0f7c11","primary_location_hint":"weur","jurisdiction":"eu"},"success":true,"errors":[],"messages":[]}`))
+	})
+
+	res, err := client.CreateDBWithOptions(context.Background(), "orders", cloudflared1.CreateDBOptions{
+		PrimaryLocationHint: cloudflared1.LocationWesternEurope,
+		Jurisdiction:        cloudflared1.JurisdictionEU,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, cloudflared1.LocationWesternEurope, res.Result.PrimaryLocationHint)
+	assert.Equal(t, cloudflared1.JurisdictionEU, res.Result.Jurisdiction)
+	id, ok := client.LookupID("orders")
+	assert.True(t, ok)
+	assert.Equal(t, "7b2c2b4e-8d1a-4a8e-9c61-3f2f0b0f7c11", id)
+}
+
+func TestTimeTravel(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/accounts/account/d1/database/db/time_travel/bookmark":
+			assert.Equal(t, http.MethodGet, r.Method)
+			if r.URL.Query().Get("timestamp") != "" {
+				assert.Equal(t, "2024-03-01T12:00:00Z", r.URL.Query().Get("timestamp"))
+				w.Write([]byte(`{"result":{"bookmark":"00000001-old"},"success":true,"errors":[],"messages":[]}`))
+				return
+			}
+			w.Write([]byte(`{"result":{"bookmark":"00000002-current"},"success":true,"errors":[],"messages":[]}`))
+		case "/accounts/account/d1/database/db/time_travel/restore":
+			assert.Equal(t, http.MethodPost, r.Method)
+			bookmark := r.URL.Query().Get("bookmark")
+			if bookmark == "" {
+				assert.Equal(t, "2024-03-01T12:00:00Z", r.URL.Query().Get("timestamp"))
+				bookmark = "00000001-old"
+			}
+			fmt.Fprintf(w, `{"result":{"bookmark":%q,"previous_bookmark":"00000002-current","message":"restored"},"success":true,"errors":[],"messages":[]}`, bookmark)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	})
+	ctx := context.Background()
+	at := time.Date(2024, 3, 1, 13, 0, 0, 0, time.FixedZone("CET", 3600))
+
+	current, err := client.GetBookmark(ctx, "db")
+	assert.NoError(t, err)
+	assert.Equal(t, "00000002-current", current.Result.Bookmark)
+	old, err := client.GetBookmarkAt(ctx, "db", at)
+	assert.NoError(t, err)
+	assert.Equal(t, "00000001-old", old.Result.Bookmark)
+
+	restored, err := client.RestoreBookmark(ctx, "db", "00000001-old")
+	assert.NoError(t, err)
+	assert.Equal(t, cloudflared1.RestoreResult{Bookmark: "00000001-old", PreviousBookmark: "00000002-current", Message: "restored"}, restored.Result)
+	restored, err = client.RestoreTimestamp(ctx, "db", at)
+	assert.NoError(t, err)
+	assert.Equal(t, "00000001-old", restored.Result.Bookmark)
+}
+
+func TestExport(t *testing.T) {
+	var polls atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dump.sql" {
+			assert.Empty(t, r.Header.Get("Authorization"))
+			w.Write([]byte("CREATE TABLE users (id INTEGER);\n"))
+			return
+		}
+		assert.Equal(t, "/accounts/account/d1/database/db/export", r.URL.Path)
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "polling", body["output_format"])
+		assert.Equal(t, map[string]any{"no_data": true, "tables": []any{"users"}}, body["dump_options"])
+		if polls.Add(1) == 1 {
+			assert.Nil(t, body["current_bookmark"])
+			w.Write([]byte(`{"result":{"at_bookmark":"bm","status":"active","success":true,"type":"export"},"success":true,"errors":[],"messages":[]}`))
+			return
+		}
+		assert.Equal(t, "bm", body["current_bookmark"])
+		fmt.Fprintf(w, `{"result":{"at_bookmark":"bm","status":"complete","success":true,"type":"export","result":{"filename":"dump.sql","signed_url":"http://%s/dump.sql"}},"success":true,"errors":[],"messages":[]}`, r.Host)
+	})
+
+	var buf bytes.Buffer
+	var progress int64
+	res, err := client.Export(context.Background(), "db", &buf, cloudflared1.ExportOptions{
+		NoData:       true,
+		Tables:       []string{"users"},
+		PollInterval: time.Millisecond,
+		Progress: func(done, total int64) {
+			progress = done
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), polls.Load())
+	assert.Equal(t, "dump.sql", res.Result.Result.Filename)
+	assert.Equal(t, "CREATE TABLE users (id INTEGER);\n", buf.String())
+	assert.Equal(t, int64(buf.Len()), progress)
+}
+
+func TestExportFailure(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":{"at_bookmark":"bm","status":"error","error":"database too large","success":false,"type":"export"},"success":true,"errors":[],"messages":[]}`))
+	})
+	_, err := client.Export(context.Background(), "db", &bytes.Buffer{}, cloudflared1.ExportOptions{})
+	assert.ErrorContains(t, err, "database too large")
+}
+
+func TestImportSQL(t *testing.T) {
+	const dump = "CREATE TABLE users (id INTEGER);\nINSERT INTO users VALUES (1);\n"
+	var steps []string
+	var uploaded []byte
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			assert.Equal(t, http.MethodPut, r.Method)
+			assert.Equal(t, int64(len(dump)), r.ContentLength)
+			uploaded, _ = io.ReadAll(r.Body)
+			sum := md5.Sum(uploaded)
+			w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(sum[:])))
+			return
+		}
+		assert.Equal(t, "/accounts/account/d1/database/db/import", r.URL.Path)
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		action := body["action"].(string)
+		steps = append(steps, action)
+		switch action {
+		case "init":
+			sum := md5.Sum([]byte(dump))
+			assert.Equal(t, hex.EncodeToString(sum[:]), body["etag"])
+			fmt.Fprintf(w, `{"result":{"filename":"dump.sql","upload_url":"http://%s/upload","success":true},"success":true,"errors":[],"messages":[]}`, r.Host)
+		case "ingest":
+			assert.Equal(t, "dump.sql", body["filename"])
+			w.Write([]byte(`{"result":{"at_bookmark":"bm","status":"active","success":true,"type":"import"},"success":true,"errors":[],"messages":[]}`))
+		case "poll":
+			assert.Equal(t, "bm", body["current_bookmark"])
+			w.Write([]byte(`{"result":{"at_bookmark":"bm","status":"complete","success":true,"type":"import","result":{"final_bookmark":"bm2","num_queries":2,"meta":{"changes":1}}},"success":true,"errors":[],"messages":[]}`))
+		}
+	})
+
+	res, err := client.ImportSQL(context.Background(), "db", strings.NewReader(dump), cloudflared1.ImportOptions{PollInterval: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"init", "ingest", "poll"}, steps)
+	assert.Equal(t, dump, string(uploaded))
+	assert.Equal(t, "bm2", res.Result.Result.FinalBookmark)
+	assert.Equal(t, 2, res.Result.Result.NumQueries)
+
+	// readers which cannot seek are buffered
+	steps = nil
+	_, err = client.ImportSQL(context.Background(), "db", io.MultiReader(strings.NewReader(dump)), cloudflared1.ImportOptions{PollInterval: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, dump, string(uploaded))
+}
+
+func TestImportSQLFailure(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			return
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["action"] == "init" {
+			fmt.Fprintf(w, `{"result":{"filename":"dump.sql","upload_url":"http://%s/upload","success":true},"success":true,"errors":[],"messages":[]}`, r.Host)
+			return
+		}
+		w.Write([]byte(`{"result":{"at_bookmark":"bm","status":"error","error":"no such table: missing","success":false,"type":"import"},"success":true,"errors":[],"messages":[]}`))
+	})
+	res, err := client.ImportSQL(context.Background(), "db", strings.NewReader("INSERT INTO missing VALUES (1);"), cloudflared1.ImportOptions{})
+	assert.ErrorContains(t, err, "no such table: missing")
+	assert.Equal(t, cloudflared1.OperationError, res.Result.Status)
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+	"github.com/google/uuid"
+)
+
+// nameCacheEntry cached database ID for a name
+type nameCacheEntry struct {
+	id      string
+	expires time.Time
+}
+
+// LookupID return the cached ID of a database by name, without contacting cloudflare.
+// Names are cached when databases are created or resolved by this client.
+func (c *Client) LookupID(dbName string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.nameIDs[dbName]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.id, true
+}
+
+// rememberID cache the ID of a database by name
+func (c *Client) rememberID(dbName string, dbID string) {
+	if c.NameCacheTTL <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nameIDs[dbName] = nameCacheEntry{
+		id:      dbID,
+		expires: time.Now().Add(c.NameCacheTTL),
+	}
+}
+
+// forgetID remove a database from the name cache
+func (c *Client) forgetID(dbID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, entry := range c.nameIDs {
+		if entry.id == dbID {
+			delete(c.nameIDs, name)
+		}
+	}
+}
+
+// ResolveID return the ID of a database given its name or ID.
+// Values which are already a UUID are returned as is. Names are looked up in the cache,
+// falling back to ListDB filtered by name.
+func (c *Client) ResolveID(ctx context.Context, nameOrID string) (string, error) {
+	if _, err := uuid.Parse(nameOrID); err == nil {
+		return nameOrID, nil
+	}
+	if id, ok := c.LookupID(nameOrID); ok {
+		return id, nil
+	}
+	// the name filter may match partially, so look for an exact match
+	for db, err := range cloudflared1.AllDatabases(ctx, c, cloudflared1.ListByName(nameOrID)) {
+		if err != nil {
+			return "", err
+		}
+		if db.Name == nameOrID {
+			id := db.UUID.String()
+			c.rememberID(db.Name, id)
+			return id, nil
+		}
+	}
+	return "", errDatabaseNotFound(nameOrID)
+}
+
+// GetDBByName retrieve information on a database by name in the cloudflare account.
+// If the cached ID is stale, the cache is refreshed and the lookup retried once.
+func (c *Client) GetDBByName(ctx context.Context, dbName string) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	_, cached := c.LookupID(dbName)
+	id, err := c.ResolveID(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.GetDB(ctx, id)
+	if cached && isNotFound(res, err) {
+		c.forgetID(id)
+		if id, err = c.ResolveID(ctx, dbName); err != nil {
+			return nil, err
+		}
+		return c.GetDB(ctx, id)
+	}
+	return res, err
+}
+
+// isNotFound check if a request failed because the database does not exist
+func isNotFound[T any](res *utils.APIResponse[T], err error) bool {
+	if err == nil {
+		err = res.Err()
+	}
+	return errors.Is(err, utils.ErrNotFound)
+}
+
+// errDatabaseNotFound error for a database name which does not exist in the account
+func errDatabaseNotFound(dbName string) error {
+	return &utils.APIError{
+		StatusCode: http.StatusNotFound,
+		Errors: []utils.D1Err{
+			{
+				Code:    7404,
+				Message: fmt.Sprintf("database %q not found", dbName),
+			},
+		},
+	}
+}
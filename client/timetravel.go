@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+var _ cloudflared1.TimeTraveler = (*Client)(nil)
+
+// GetBookmark retrieve the bookmark of the current state of a database by id.
+func (c *Client) GetBookmark(ctx context.Context, dbID string) (*utils.APIResponse[cloudflared1.Bookmark], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/time_travel/bookmark", c.BaseURL, c.AccountID, dbID)
+	return utils.DoRequest[cloudflared1.Bookmark](ctx, c.requestConfig(true), "GET", url, nil)
+}
+
+// GetBookmarkAt retrieve the bookmark nearest to, but not after, the given time.
+func (c *Client) GetBookmarkAt(ctx context.Context, dbID string, at time.Time) (*utils.APIResponse[cloudflared1.Bookmark], error) {
+	query := url.Values{}
+	query.Set("timestamp", at.UTC().Format(time.RFC3339))
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/time_travel/bookmark?%s", c.BaseURL, c.AccountID, dbID, query.Encode())
+	return utils.DoRequest[cloudflared1.Bookmark](ctx, c.requestConfig(true), "GET", url, nil)
+}
+
+// RestoreBookmark restore a database by id to the state identified by bookmark.
+// The result holds the bookmark from before the restore, which can be restored to undo it.
+func (c *Client) RestoreBookmark(ctx context.Context, dbID string, bookmark string) (*utils.APIResponse[cloudflared1.RestoreResult], error) {
+	query := url.Values{}
+	query.Set("bookmark", bookmark)
+	return c.restore(ctx, dbID, query)
+}
+
+// RestoreTimestamp restore a database by id to its state at the given time.
+// The result holds the bookmark from before the restore, which can be restored to undo it.
+func (c *Client) RestoreTimestamp(ctx context.Context, dbID string, at time.Time) (*utils.APIResponse[cloudflared1.RestoreResult], error) {
+	query := url.Values{}
+	query.Set("timestamp", at.UTC().Format(time.RFC3339))
+	return c.restore(ctx, dbID, query)
+}
+
+func (c *Client) restore(ctx context.Context, dbID string, query url.Values) (*utils.APIResponse[cloudflared1.RestoreResult], error) {
+	url := fmt.Sprintf("%s/accounts/%s/d1/database/%s/time_travel/restore?%s", c.BaseURL, c.AccountID, dbID, query.Encode())
+	return utils.DoRequest[cloudflared1.RestoreResult](ctx, c.requestConfig(false), "POST", url, nil)
+}
@@ -11,14 +11,26 @@ import (
 // https://developers.cloudflare.com/api/resources/d1/subresources/database/
 type CloudflareD1 interface {
 	CreateDB(ctx context.Context, dbName string) (*utils.APIResponse[D1Database], error)
+	// CreateDBWithOptions create a database pinned to a primary location or jurisdiction
+	CreateDBWithOptions(ctx context.Context, dbName string, opts CreateDBOptions) (*utils.APIResponse[D1Database], error)
 	DeleteDB(ctx context.Context, dbID string) (*utils.APIResponse[DeleteResult], error)
 	UpdateDB(ctx context.Context, dbID string, settings DBSettings) (*utils.APIResponse[D1Database], error)
 	GetDB(ctx context.Context, dbID string) (*utils.APIResponse[D1Database], error)
-	ListDB(ctx context.Context) (*utils.APIResponse[D1DatabaseList], error)
-	// NOTE: It would be awesome to template this interface so we could specify the exact format of the data expected with each call.
-	// unforutnately, that is not allowed in golang
+	// ListDB list databases in the account, one page at a time. Use AllDatabases to iterate over every page.
+	ListDB(ctx context.Context, opts ...ListDBOption) (*utils.APIResponse[D1DatabaseList], error)
+	// GetDBByName retrieve a database by name rather than ID
+	GetDBByName(ctx context.Context, dbName string) (*utils.APIResponse[D1Database], error)
+	// ResolveID return the ID of a database given its name or ID
+	ResolveID(ctx context.Context, nameOrID string) (string, error)
+	// NOTE: methods cannot be generic in golang, so results are returned untyped.
+	// Use the package level Query and QueryOne functions to scan rows into structs.
 	QueryDB(ctx context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]QueryResult[any]], error)
-	QueryDBRaw(ctx context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]QueryResult[any]], error)
+	// QueryDBRaw execute a query returning rows as arrays, preserving column order and duplicate column names
+	QueryDBRaw(ctx context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]RawResult], error)
+	// BatchQuery execute multiple statements atomically in a single request, returning one result per statement
+	BatchQuery(ctx context.Context, dbID string, statements []Statement) (*utils.APIResponse[[]QueryResult[any]], error)
+	// BatchQueryRaw execute multiple statements atomically in a single request, returning rows as arrays
+	BatchQueryRaw(ctx context.Context, dbID string, statements []Statement) (*utils.APIResponse[[]RawResult], error)
 }
 
 type ReadReplicationMode int
@@ -63,14 +75,44 @@ type DBSettings struct {
 	Replication ReadReplicationMode `json:"replication"`
 }
 
+// LocationHint region a database's primary instance is placed near
+type LocationHint string
+
+const (
+	LocationWesternNorthAmerica LocationHint = "wnam"
+	LocationEasternNorthAmerica LocationHint = "enam"
+	LocationWesternEurope       LocationHint = "weur"
+	LocationEasternEurope       LocationHint = "eeur"
+	LocationAsiaPacific         LocationHint = "apac"
+	LocationOceania             LocationHint = "oc"
+)
+
+// Jurisdiction restricts where a database's data is stored and processed
+type Jurisdiction string
+
+const (
+	JurisdictionEU      Jurisdiction = "eu"
+	JurisdictionFedRAMP Jurisdiction = "fedramp"
+)
+
+// CreateDBOptions optional placement settings for a new database
+type CreateDBOptions struct {
+	// PrimaryLocationHint region to place the primary instance near
+	PrimaryLocationHint LocationHint `json:"primary_location_hint,omitempty"`
+	// Jurisdiction data residency requirement of the database
+	Jurisdiction Jurisdiction `json:"jurisdiction,omitempty"`
+}
+
 type D1Database struct {
-	CreatedAt       string          `json:"created_at"`
-	FileSize        int64           `json:"file_size"`
-	Name            string          `json:"name"`
-	NumTables       int             `json:"num_tables"`
-	ReadReplication ReadReplication `json:"read_replication"`
-	UUID            uuid.UUID       `json:"uuid"`
-	Version         string          `json:"version"`
+	CreatedAt           string          `json:"created_at"`
+	FileSize            int64           `json:"file_size"`
+	Jurisdiction        Jurisdiction    `json:"jurisdiction,omitempty"`
+	Name                string          `json:"name"`
+	NumTables           int             `json:"num_tables"`
+	PrimaryLocationHint LocationHint    `json:"primary_location_hint,omitempty"`
+	ReadReplication     ReadReplication `json:"read_replication"`
+	UUID                uuid.UUID       `json:"uuid"`
+	Version             string          `json:"version"`
 }
 
 type Meta struct {
@@ -96,6 +138,60 @@ type QueryResult[T any] struct {
 	Success bool `json:"success"`
 }
 
+// RawResult result of a statement from the raw query endpoint.
+// Each row holds values in the same order as Columns.
+type RawResult struct {
+	Columns []string
+	Rows    [][]any
+	Meta    Meta
+	Success bool
+}
+
+// rawResultJSON wire format of RawResult, which nests columns and rows under results
+type rawResultJSON struct {
+	Meta    Meta `json:"meta"`
+	Results struct {
+		Columns []string `json:"columns"`
+		Rows    [][]any  `json:"rows"`
+	} `json:"results"`
+	Success bool `json:"success"`
+}
+
+func (r RawResult) MarshalJSON() ([]byte, error) {
+	var out rawResultJSON
+	out.Meta = r.Meta
+	out.Success = r.Success
+	out.Results.Columns = r.Columns
+	if out.Results.Columns == nil {
+		out.Results.Columns = []string{}
+	}
+	out.Results.Rows = r.Rows
+	if out.Results.Rows == nil {
+		out.Results.Rows = [][]any{}
+	}
+	return json.Marshal(out)
+}
+
+func (r *RawResult) UnmarshalJSON(data []byte) error {
+	var in rawResultJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*r = RawResult{
+		Columns: in.Results.Columns,
+		Rows:    in.Results.Rows,
+		Meta:    in.Meta,
+		Success: in.Success,
+	}
+	return nil
+}
+
+// Statement a single SQL statement and its parameters, executed as part of a batch
+type Statement struct {
+	SQL    string `json:"sql"`
+	Params []any  `json:"params"`
+}
+
 type DeleteResult struct{}
 
 type D1DatabaseList []D1Database
@@ -0,0 +1,169 @@
+// Command d1-mock-server serves the Cloudflare D1 REST API over HTTP, backed by the sqlite databases of
+// mock.MockClient, so any HTTP client can develop against D1 locally.
+//
+//	d1-mock-server -port 8787 -dir ./d1 -token dev-token -account dev-account -seed ./seed
+//
+// Point clients at http://localhost:8787/client/v4 in place of https://api.cloudflare.com/client/v4.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/fakeserver"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+)
+
+// shutdownTimeout how long in flight requests are given to finish on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// stringList flag which may be given more than once, or as a comma separated list
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "d1-mock-server:", err)
+		os.Exit(1)
+	}
+}
+
+// run parse args, seed the databases and serve until ctx is done
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	var tokens, accounts stringList
+	fs := flag.NewFlagSet("d1-mock-server", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	port := fs.Int("port", 8787, "port to listen on")
+	host := fs.String("host", "localhost", "interface to listen on")
+	dir := fs.String("dir", ".d1-mock", "directory holding the sqlite file of each database")
+	seedDir := fs.String("seed", "", "directory of <name>.sql files, each creating and filling database <name> if it does not exist")
+	logRequests := fs.Bool("log", true, "log each request")
+	fs.Var(&tokens, "token", "accepted bearer token, may be repeated (default any token)")
+	fs.Var(&accounts, "account", "accepted account ID, may be repeated (default any account)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger := slog.New(slog.NewTextHandler(stderr, nil))
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	m, err := mock.NewMockClient(*dir)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if *seedDir != "" {
+		if err := seed(ctx, m, *seedDir, logger); err != nil {
+			return err
+		}
+	}
+
+	opts := []fakeserver.Option{fakeserver.WithTokens(tokens...), fakeserver.WithAccountIDs(accounts...)}
+	if *logRequests {
+		opts = append(opts, fakeserver.WithLogger(logger))
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(*host, strconv.Itoa(*port)))
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           fakeserver.New(m, opts...),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	logger.Info("serving D1 API", "url", "http://"+listener.Addr().String()+"/client/v4", "dir", *dir)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// seed create a database for each <name>.sql file in dir and import the file into it. Databases
+// which already exist are left untouched, so restarting on a persistent directory does not apply
+// the files twice.
+func seed(ctx context.Context, m *mock.MockClient, dir string, logger *slog.Logger) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	slices.Sort(files)
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".sql")
+		if _, ok := m.LookupID(name); ok {
+			logger.Info("database exists, not seeding", "database", name)
+			continue
+		}
+		if err := seedDB(ctx, m, name, file); err != nil {
+			return fmt.Errorf("seeding %s from %s: %w", name, file, err)
+		}
+		logger.Info("seeded database", "database", name, "file", file)
+	}
+	return nil
+}
+
+// seedDB create database name and import file into it, removing the database again if the import fails
+func seedDB(ctx context.Context, m *mock.MockClient, name string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	created, err := m.CreateDB(ctx, name)
+	if err != nil {
+		return err
+	}
+	dbID := created.Result.UUID.String()
+	res, err := m.ImportSQL(ctx, dbID, f, cloudflared1.ImportOptions{})
+	if err == nil {
+		err = res.Err()
+	}
+	if err != nil {
+		m.DeleteDB(ctx, dbID)
+		return err
+	}
+	return nil
+}
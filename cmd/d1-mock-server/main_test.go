@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringList(t *testing.T) {
+	var l stringList
+	assert.NoError(t, l.Set("a, b"))
+	assert.NoError(t, l.Set("c"))
+	assert.Equal(t, stringList{"a", "b", "c"}, l)
+	assert.Equal(t, "a,b,c", l.String())
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	seedDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(seedDir, "users.sql"), []byte(`
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
+INSERT INTO users (name) VALUES ('alice'), ('bob');
+`), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(seedDir, "notes.txt"), []byte("not sql"), 0o644))
+
+	dir := t.TempDir()
+	m, err := mock.NewMockClient(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, seed(ctx, m, seedDir, logger))
+	dbID, ok := m.LookupID("users")
+	assert.True(t, ok)
+	count, _, err := cloudflared1.QueryOne[int](ctx, m, dbID, "SELECT count(*) FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	list, err := m.ListDB(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list.Result, 1)
+	assert.NoError(t, m.Close())
+
+	// existing databases are not seeded again
+	m, err = mock.NewMockClient(dir)
+	assert.NoError(t, err)
+	defer m.Close()
+	assert.NoError(t, seed(ctx, m, seedDir, logger))
+	count, _, err = cloudflared1.QueryOne[int](ctx, m, dbID, "SELECT count(*) FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// a failed seed leaves no database behind
+	assert.NoError(t, os.WriteFile(filepath.Join(seedDir, "broken.sql"), []byte("INSERT INTO missing VALUES (1);"), 0o644))
+	assert.ErrorContains(t, seed(ctx, m, seedDir, logger), "no such table")
+	_, ok = m.LookupID("broken")
+	assert.False(t, ok)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+// check combine the error of a call with the error of its response, which the mock and lenient
+// clients report as a failed response rather than an error
+func check[T any](res *utils.APIResponse[T], err error) (*utils.APIResponse[T], error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func runCreate(ctx context.Context, a *app, args []string) error {
+	var opts cloudflared1.CreateDBOptions
+	fs := a.flagSet("create")
+	fs.Func("location", "primary location `hint`: wnam, enam, weur, eeur, apac or oc", func(s string) error {
+		opts.PrimaryLocationHint = cloudflared1.LocationHint(s)
+		return nil
+	})
+	fs.Func("jurisdiction", "data residency `jurisdiction`: eu or fedramp", func(s string) error {
+		opts.Jurisdiction = cloudflared1.Jurisdiction(s)
+		return nil
+	})
+	args, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	d1, close, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer close()
+	res, err := check(d1.CreateDBWithOptions(ctx, args[0], opts))
+	if err != nil {
+		return err
+	}
+	return writeDatabases(a.stdout, a.format, []cloudflared1.D1Database{res.Result}, true)
+}
+
+func runDelete(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flagSet("delete"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	d1, close, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer close()
+	dbID, err := d1.ResolveID(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	_, err = check(d1.DeleteDB(ctx, dbID))
+	return err
+}
+
+func runGet(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flagSet("get"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	d1, close, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer close()
+	dbID, err := d1.ResolveID(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	res, err := check(d1.GetDB(ctx, dbID))
+	if err != nil {
+		return err
+	}
+	return writeDatabases(a.stdout, a.format, []cloudflared1.D1Database{res.Result}, true)
+}
+
+func runList(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("list")
+	name := fs.String("name", "", "only list databases whose name contains `filter`")
+	if _, err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	d1, close, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer close()
+	var dbs []cloudflared1.D1Database
+	for db, err := range cloudflared1.AllDatabases(ctx, d1, cloudflared1.ListByName(*name)) {
+		if err != nil {
+			return err
+		}
+		dbs = append(dbs, db)
+	}
+	return writeDatabases(a.stdout, a.format, dbs, false)
+}
+
+func runUpdate(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("update")
+	mode := fs.String("replication", "", "read replication `mode`: auto or disabled")
+	args, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	var settings cloudflared1.DBSettings
+	switch *mode {
+	case cloudflared1.ReadReplicationModeAuto.String():
+		settings.Replication = cloudflared1.ReadReplicationModeAuto
+	case cloudflared1.ReadReplicationModeDisabled.String():
+		settings.Replication = cloudflared1.ReadReplicationModeDisabled
+	default:
+		fs.Usage()
+		return fmt.Errorf("-replication must be auto or disabled, got %q", *mode)
+	}
+	d1, close, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer close()
+	dbID, err := d1.ResolveID(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	res, err := check(d1.UpdateDB(ctx, dbID, settings))
+	if err != nil {
+		return err
+	}
+	return writeDatabases(a.stdout, a.format, []cloudflared1.D1Database{res.Result}, true)
+}
+
+func runQuery(ctx context.Context, a *app, args []string) error {
+	return a.runSQL(ctx, "query", args, true)
+}
+
+func runRaw(ctx context.Context, a *app, args []string) error {
+	return a.runSQL(ctx, "raw", args, false)
+}
+
+// runSQL run the SQL given by args and print its results. The raw endpoint is used for both commands
+// so columns are printed in the order they were selected.
+func (a *app) runSQL(ctx context.Context, name string, args []string, objects bool) error {
+	args, err := a.parse(a.flagSet(name), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	sql := "-"
+	if len(args) > 1 {
+		sql = args[1]
+	}
+	if sql == "-" {
+		data, err := io.ReadAll(a.stdin)
+		if err != nil {
+			return err
+		}
+		sql = string(data)
+	}
+	params := make([]any, 0, len(args))
+	for _, p := range args[min(len(args), 2):] {
+		params = append(params, p)
+	}
+	d1, close, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer close()
+	dbID, err := d1.ResolveID(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	res, err := check(d1.QueryDBRaw(ctx, dbID, sql, params...))
+	if err != nil {
+		return err
+	}
+	return writeResults(a.stdout, a.format, res.Result, objects)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+)
+
+// output formats selected with --format
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+)
+
+var formats = []string{formatTable, formatJSON, formatNDJSON, formatCSV}
+
+// databaseColumns columns printed for databases in the table and csv formats
+var databaseColumns = []string{"uuid", "name", "created_at", "version", "num_tables", "file_size", "read_replication", "primary_location_hint", "jurisdiction"}
+
+// writeDatabases print databases in format. A single database is printed as a JSON object rather than an array.
+func writeDatabases(w io.Writer, format string, dbs []cloudflared1.D1Database, single bool) error {
+	switch format {
+	case formatJSON:
+		if single && len(dbs) == 1 {
+			return writeJSON(w, dbs[0])
+		}
+		if dbs == nil {
+			dbs = []cloudflared1.D1Database{}
+		}
+		return writeJSON(w, dbs)
+	case formatNDJSON:
+		for _, db := range dbs {
+			if err := writeJSON(w, db); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	rows := make([][]any, len(dbs))
+	for i, db := range dbs {
+		rows[i] = []any{db.UUID.String(), db.Name, db.CreatedAt, db.Version, db.NumTables, db.FileSize,
+			db.ReadReplication.Mode.String(), string(db.PrimaryLocationHint), string(db.Jurisdiction)}
+	}
+	return writeTabular(w, format, databaseColumns, rows)
+}
+
+// writeResults print the rows of each statement which returned columns. With objects rows are
+// printed as JSON objects keyed by column, otherwise as arrays with the columns printed first.
+// Multiple result sets are printed one after another, separated by a blank line in the table and csv formats.
+func writeResults(w io.Writer, format string, results []cloudflared1.RawResult, objects bool) error {
+	first := true
+	for _, res := range results {
+		if len(res.Columns) == 0 {
+			continue
+		}
+		if !first && (format == formatTable || format == formatCSV) {
+			fmt.Fprintln(w)
+		}
+		first = false
+		if err := writeResult(w, format, res, objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeResult(w io.Writer, format string, res cloudflared1.RawResult, objects bool) error {
+	switch format {
+	case formatJSON:
+		if !objects {
+			return writeJSON(w, struct {
+				Columns []string `json:"columns"`
+				Rows    [][]any  `json:"rows"`
+			}{res.Columns, nonNil(res.Rows)})
+		}
+		out := make([]orderedRow, len(res.Rows))
+		for i, row := range res.Rows {
+			out[i] = orderedRow{res.Columns, row}
+		}
+		return writeJSON(w, out)
+	case formatNDJSON:
+		if !objects {
+			if err := writeJSON(w, res.Columns); err != nil {
+				return err
+			}
+		}
+		for _, row := range res.Rows {
+			var v any = row
+			if objects {
+				v = orderedRow{res.Columns, row}
+			}
+			if err := writeJSON(w, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return writeTabular(w, format, res.Columns, res.Rows)
+}
+
+// writeTabular print columns and rows as an aligned table or csv
+func writeTabular(w io.Writer, format string, columns []string, rows [][]any) error {
+	if format == formatCSV {
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		for _, row := range rows {
+			record := make([]string, len(row))
+			for i, v := range row {
+				record[i] = formatValue(v, "")
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			// tabs and newlines would break the alignment of the table
+			cells[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(formatValue(v, "NULL"))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// formatValue text of a value decoded from JSON, printing null as null.
+// Integral numbers are printed without an exponent so large IDs stay readable.
+func formatValue(v any, null string) string {
+	switch v := v.(type) {
+	case nil:
+		return null
+	case string:
+		return v
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// orderedRow row encoded as a JSON object with keys in column order
+type orderedRow struct {
+	columns []string
+	values  []any
+}
+
+func (r orderedRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range r.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if i < len(r.values) {
+			value = r.values[i]
+		}
+		val, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// writeJSON write v as a line of JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
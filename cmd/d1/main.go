@@ -0,0 +1,204 @@
+// Command d1 manages and queries Cloudflare D1 databases.
+//
+//	d1 [flags] <command> [flags] [args]
+//
+// Credentials are read from CLOUDFLARE_ACCOUNT_ID and CLOUDFLARE_API_TOKEN. With --mock <dir> commands run
+// against the sqlite databases of a mock.MockClient in dir instead. Databases may be given by name or ID.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/client"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+)
+
+// environment variables holding the credentials of the API
+const (
+	envAccountID = "CLOUDFLARE_ACCOUNT_ID"
+	envAPIToken  = "CLOUDFLARE_API_TOKEN"
+)
+
+// command subcommand of d1
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+// commands every subcommand, in the order they are listed in the usage. It is set by init as the
+// commands look themselves up in it for their usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"create", "<name>", "create a database", runCreate},
+		{"delete", "<db>", "delete a database", runDelete},
+		{"get", "<db>", "show a database", runGet},
+		{"list", "", "list databases", runList},
+		{"update", "-replication auto|disabled <db>", "change the read replication mode of a database", runUpdate},
+		{"query", "<db> [sql] [params...]", "run SQL, printing rows as objects. SQL is read from stdin when omitted or -", runQuery},
+		{"raw", "<db> [sql] [params...]", "run SQL, printing rows as arrays with their columns", runRaw},
+		{"shell", "<db>", "run an interactive SQL shell on a database, or the statements piped to it", runShell},
+		{"migrations", "list <db> | apply <db> | create <description>", "list, apply or create the migrations in -dir", runMigrations},
+	}
+}
+
+// app state shared by the subcommands
+type app struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+	// mockDir directory of the mock databases to use in place of the API, set by --mock
+	mockDir string
+	// format output format, set by --format
+	format string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	a := &app{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv}
+	err := a.run(ctx, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "d1:", err)
+		os.Exit(1)
+	}
+}
+
+// run parse the global flags and run the subcommand named by args
+func (a *app) run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("d1", flag.ContinueOnError)
+	a.globalFlags(fs)
+	fs.Usage = func() { a.usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		a.usage(fs)
+		return errors.New("no command given")
+	}
+	name := fs.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(ctx, a, fs.Args()[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %q, run d1 -h for usage", name)
+}
+
+// globalFlags register the flags accepted before and after any subcommand
+func (a *app) globalFlags(fs *flag.FlagSet) {
+	fs.SetOutput(a.stderr)
+	if a.format == "" {
+		a.format = formatTable
+	}
+	fs.StringVar(&a.mockDir, "mock", a.mockDir, "run against the mock databases in `dir` instead of the API")
+	fs.StringVar(&a.format, "format", a.format, "output `format`: "+strings.Join(formats, ", "))
+	fs.StringVar(&a.format, "o", a.format, "shorthand for -`format`")
+}
+
+func (a *app) usage(fs *flag.FlagSet) {
+	fmt.Fprintln(a.stderr, "usage: d1 [flags] <command> [flags] [args]")
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "Credentials are read from "+envAccountID+" and "+envAPIToken+". Databases may be given by name or ID.")
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(a.stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "flags:")
+	fs.PrintDefaults()
+}
+
+// flagSet flags of a subcommand, including the global flags
+func (a *app) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("d1 "+name, flag.ContinueOnError)
+	a.globalFlags(fs)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			fs.Usage = func() {
+				fmt.Fprintf(a.stderr, "usage: d1 %s %s\n\n%s\n\nflags:\n", name, cmd.args, cmd.summary)
+				fs.PrintDefaults()
+			}
+		}
+	}
+	return fs
+}
+
+// parse parse args, allowing flags between the positional arguments, and check the number of
+// positional arguments is within [min, max]. A max below 0 allows any number. Arguments after --
+// are never treated as flags.
+func (a *app) parse(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		// the flag package consumes --, leaving everything after it positional
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		fs.Usage()
+		return nil, fmt.Errorf("%s: wrong number of arguments", fs.Name())
+	}
+	if err := a.checkFormat(); err != nil {
+		return nil, err
+	}
+	return positional, nil
+}
+
+func (a *app) checkFormat() error {
+	if !slices.Contains(formats, a.format) {
+		return fmt.Errorf("unknown format %q, must be one of %s", a.format, strings.Join(formats, ", "))
+	}
+	return nil
+}
+
+// open the database service commands run against, the mock when --mock is set and the API otherwise.
+// The returned function releases it.
+func (a *app) open() (cloudflared1.CloudflareD1, func() error, error) {
+	if a.mockDir != "" {
+		if err := os.MkdirAll(a.mockDir, 0o755); err != nil {
+			return nil, nil, err
+		}
+		m, err := mock.NewMockClient(a.mockDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return m, m.Close, nil
+	}
+	accountID, token := a.getenv(envAccountID), a.getenv(envAPIToken)
+	if accountID == "" || token == "" {
+		return nil, nil, fmt.Errorf("%s and %s must be set, or --mock given", envAccountID, envAPIToken)
+	}
+	c, err := client.NewClient(accountID, token, client.WithErrorOnFailure())
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, func() error { return nil }, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// newApp app running against the mock databases in a temporary directory
+func newApp(t *testing.T) (*app, *bytes.Buffer) {
+	var stdout bytes.Buffer
+	return &app{
+		stdin:   strings.NewReader(""),
+		stdout:  &stdout,
+		stderr:  &bytes.Buffer{},
+		getenv:  func(string) string { return "" },
+		mockDir: t.TempDir(),
+	}, &stdout
+}
+
+// run the command given by args, returning its output
+func run(t *testing.T, a *app, stdout *bytes.Buffer, args ...string) string {
+	t.Helper()
+	stdout.Reset()
+	a.format = ""
+	assert.NoError(t, a.run(context.Background(), args))
+	return stdout.String()
+}
+
+func TestDatabaseCommands(t *testing.T) {
+	a, stdout := newApp(t)
+
+	var created cloudflared1.D1Database
+	out := run(t, a, stdout, "-o", "json", "create", "orders", "-location", "weur")
+	assert.NoError(t, json.Unmarshal([]byte(out), &created))
+	assert.Equal(t, "orders", created.Name)
+	assert.Equal(t, cloudflared1.LocationWesternEurope, created.PrimaryLocationHint)
+	run(t, a, stdout, "create", "users")
+
+	// names and IDs are both accepted
+	out = run(t, a, stdout, "get", "-format", "json", created.UUID.String())
+	assert.Contains(t, out, `"name":"orders"`)
+	out = run(t, a, stdout, "update", "orders", "-replication", "auto", "-o", "csv")
+	assert.Contains(t, out, created.UUID.String()+",orders,")
+	assert.Contains(t, out, ",auto,weur,")
+
+	out = run(t, a, stdout, "list", "-o", "table")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "uuid "))
+	assert.Contains(t, lines[1], "orders")
+	assert.Contains(t, lines[2], "users")
+	out = run(t, a, stdout, "list", "-o", "ndjson", "-name", "user")
+	assert.Equal(t, 1, strings.Count(out, "\n"))
+
+	run(t, a, stdout, "delete", "users")
+	out = run(t, a, stdout, "list", "-o", "json")
+	var dbs []cloudflared1.D1Database
+	assert.NoError(t, json.Unmarshal([]byte(out), &dbs))
+	assert.Len(t, dbs, 1)
+
+	assert.ErrorContains(t, a.run(context.Background(), []string{"get", "users"}), "Invalid db id")
+	assert.ErrorContains(t, a.run(context.Background(), []string{"update", "orders", "-replication", "sometimes"}), "auto or disabled")
+}
+
+func TestQueryCommands(t *testing.T) {
+	a, stdout := newApp(t)
+	run(t, a, stdout, "create", "shop")
+	a.stdin = strings.NewReader(`
+CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, note TEXT);
+INSERT INTO items (name, note) VALUES ('apple', NULL), ('pear, green', 'ripe');
+`)
+	assert.Equal(t, "", run(t, a, stdout, "query", "shop"))
+
+	out := run(t, a, stdout, "query", "shop", "SELECT name, id FROM items WHERE id = ?", "1")
+	assert.Equal(t, "name   id\napple  1\n", out)
+	out = run(t, a, stdout, "-o", "json", "query", "shop", "SELECT name, id, note FROM items")
+	assert.Equal(t, `[{"name":"apple","id":1,"note":null},{"name":"pear, green","id":2,"note":"ripe"}]`+"\n", out)
+	out = run(t, a, stdout, "query", "-o", "ndjson", "shop", "SELECT id FROM items")
+	assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n", out)
+	out = run(t, a, stdout, "query", "-o", "csv", "shop", "SELECT name, note FROM items; SELECT count(*) AS n FROM items")
+	assert.Equal(t, "name,note\napple,\n\"pear, green\",ripe\n\nn\n2\n", out)
+
+	out = run(t, a, stdout, "raw", "-o", "json", "shop", "SELECT id, id FROM items WHERE name = ?", "apple")
+	assert.Equal(t, `{"columns":["id","id"],"rows":[[1,1]]}`+"\n", out)
+	out = run(t, a, stdout, "raw", "-o", "ndjson", "shop", "SELECT id, name FROM items")
+	assert.Equal(t, "[\"id\",\"name\"]\n[1,\"apple\"]\n[2,\"pear, green\"]\n", out)
+
+	// parameters after -- are never flags
+	out = run(t, a, stdout, "query", "shop", "--", "SELECT ? AS v", "-o")
+	assert.Equal(t, "v\n-o\n", out)
+
+	assert.ErrorContains(t, a.run(context.Background(), []string{"query", "shop", "SELECT * FROM missing"}), "no such table")
+}
+
+func TestUsageErrors(t *testing.T) {
+	a, _ := newApp(t)
+	ctx := context.Background()
+	assert.ErrorContains(t, a.run(ctx, nil), "no command given")
+	assert.ErrorContains(t, a.run(ctx, []string{"frobnicate"}), "unknown command")
+	assert.ErrorContains(t, a.run(ctx, []string{"get"}), "wrong number of arguments")
+	assert.ErrorContains(t, a.run(ctx, []string{"-o", "xml", "list"}), "unknown format")
+	a.format = ""
+
+	// without --mock the API credentials are required
+	a.mockDir = ""
+	assert.ErrorContains(t, a.run(ctx, []string{"list"}), envAccountID)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/migrate"
+)
+
+// migrationColumns columns printed for migrations
+var migrationColumns = []string{"name", "status", "applied_at"}
+
+func runMigrations(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("migrations")
+	dir := fs.String("dir", migrate.DefaultDir, "`directory` holding the migration files")
+	table := fs.String("table", migrate.DefaultTable, "`table` applied migrations are recorded in")
+	args, err := a.parse(fs, args, 2, -1)
+	if err != nil {
+		return err
+	}
+	action := args[0]
+	if action == "create" {
+		path, err := migrate.Create(*dir, strings.Join(args[1:], " "))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(a.stdout, path)
+		return nil
+	}
+	if action != "list" && action != "apply" {
+		fs.Usage()
+		return fmt.Errorf("unknown migrations command %q, must be list, apply or create", action)
+	}
+	if len(args) != 2 {
+		fs.Usage()
+		return fmt.Errorf("%s: wrong number of arguments", fs.Name())
+	}
+	d1, close, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer close()
+	dbID, err := d1.ResolveID(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	migrator := migrate.New(d1, dbID, os.DirFS(*dir), migrate.WithTable(*table))
+	if action == "list" {
+		migrations, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return writeMigrations(a, migrations)
+	}
+	applied, err := migrator.Apply(ctx)
+	if len(applied) == 0 && err == nil {
+		fmt.Fprintln(a.stderr, "No migrations to apply.")
+		return nil
+	}
+	// report what was applied before any failure
+	if writeErr := writeMigrations(a, applied); err == nil {
+		err = writeErr
+	}
+	return err
+}
+
+// writeMigrations print migrations with whether and when they were applied
+func writeMigrations(a *app, migrations []migrate.Migration) error {
+	res := cloudflared1.RawResult{Columns: migrationColumns}
+	for _, m := range migrations {
+		status, appliedAt := "pending", any(nil)
+		if m.Applied {
+			status, appliedAt = "applied", m.AppliedAt.Format(time.RFC3339)
+		}
+		res.Rows = append(res.Rows, []any{m.Name, status, appliedAt})
+	}
+	return writeResult(a.stdout, a.format, res, true)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrationCommands(t *testing.T) {
+	a, stdout := newApp(t)
+	dir := filepath.Join(t.TempDir(), "migrations")
+	run(t, a, stdout, "create", "shop")
+
+	out := run(t, a, stdout, "migrations", "create", "-dir", dir, "create", "items")
+	path := filepath.Join(dir, "0001_create_items.sql")
+	assert.Equal(t, path+"\n", out)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteString("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT);\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "0002_seed.sql"), []byte("INSERT INTO items (name) VALUES ('apple');"), 0o644))
+
+	out = run(t, a, stdout, "migrations", "list", "-dir", dir, "-o", "csv", "shop")
+	assert.Equal(t, "name,status,applied_at\n0001_create_items.sql,pending,\n0002_seed.sql,pending,\n", out)
+
+	out = run(t, a, stdout, "migrations", "apply", "-dir", dir, "shop")
+	assert.Regexp(t, regexp.MustCompile(`(?m)^0001_create_items\.sql\s+applied\s+\d{4}-`), out)
+	assert.Regexp(t, regexp.MustCompile(`(?m)^0002_seed\.sql\s+applied\s+\d{4}-`), out)
+	out = run(t, a, stdout, "query", "-o", "csv", "shop", "SELECT name FROM items")
+	assert.Equal(t, "name\napple\n", out)
+
+	var stderr bytes.Buffer
+	a.stderr = &stderr
+	assert.Equal(t, "", run(t, a, stdout, "migrations", "apply", "-dir", dir, "shop"))
+	assert.Equal(t, "No migrations to apply.\n", stderr.String())
+	out = run(t, a, stdout, "migrations", "list", "-dir", dir, "-o", "ndjson", "shop")
+	assert.Regexp(t, `^\{"name":"0001_create_items.sql","status":"applied","applied_at":"\d{4}-`, out)
+
+	assert.ErrorContains(t, a.run(context.Background(), []string{"migrations", "undo", "shop"}), "unknown migrations command")
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+	"golang.org/x/term"
+)
+
+// maxHistory number of lines of history kept
+const maxHistory = 1000
+
+const shellHelp = `.exit                  exit the shell
+.help                  show this message
+.mode [FORMAT]         set the output format to table, json, ndjson or csv, or show it
+.quit                  exit the shell
+.schema [TABLE]        show the CREATE statements of every table, or those matching TABLE
+.tables                list the tables and views
+.timer on|off          show the duration, rows read and written and region of each query
+`
+
+// userObjects condition on sqlite_master excluding the internal tables of sqlite and cloudflare
+const userObjects = "name NOT GLOB 'sqlite_*' AND name NOT GLOB '_cf_*'"
+
+// schemaChange matches SQL which may change the tables and columns offered by completion
+var schemaChange = regexp.MustCompile(`(?i)\b(CREATE|ALTER|DROP)\b`)
+
+// lineReader source of the lines entered in the shell
+type lineReader interface {
+	ReadLine() (string, error)
+	SetPrompt(prompt string)
+}
+
+// scriptReader lineReader of input which is not a terminal, such as a piped file, which is read without prompts
+type scriptReader struct {
+	*bufio.Scanner
+}
+
+func (r scriptReader) ReadLine() (string, error) {
+	if r.Scan() {
+		return r.Text(), nil
+	}
+	if err := r.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+func (scriptReader) SetPrompt(string) {}
+
+const keyCtrlC = 3
+
+// clearLine keys moving to the end of the line, deleting it and entering the now empty line, which
+// term.Terminal is given in place of Ctrl-C, on which it would report the end of its input.
+var clearLine = []byte{5, 21, '\r'}
+
+// keyboard reads ahead from a raw terminal, so Ctrl-C is seen while a query runs as well as while a
+// line is being entered. Ctrl-C cancels a running query, or else clears the line being entered.
+type keyboard struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// buf keys read but not yet passed on
+	buf []byte
+	err error
+	// interrupts lines cleared by Ctrl-C but not yet reported by interrupted
+	interrupts int
+	// cancel the running query, if any
+	cancel context.CancelFunc
+}
+
+func newKeyboard(r io.Reader) *keyboard {
+	k := &keyboard{}
+	k.cond = sync.NewCond(&k.mu)
+	go k.readAhead(r)
+	return k
+}
+
+func (k *keyboard) readAhead(r io.Reader) {
+	p := make([]byte, 256)
+	for {
+		n, err := r.Read(p)
+		k.mu.Lock()
+		for _, key := range p[:n] {
+			if key == keyCtrlC && k.cancel != nil {
+				k.cancel()
+				k.cancel = nil
+				continue
+			}
+			k.buf = append(k.buf, key)
+		}
+		k.err = err
+		k.cond.Broadcast()
+		k.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read keys up to the next Ctrl-C, which is passed on alone as clearLine
+func (k *keyboard) Read(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for len(k.buf) == 0 && k.err == nil {
+		k.cond.Wait()
+	}
+	if len(k.buf) == 0 {
+		return 0, k.err
+	}
+	if k.buf[0] == keyCtrlC {
+		k.buf = k.buf[1:]
+		k.interrupts++
+		return copy(p, clearLine), nil
+	}
+	end := len(k.buf)
+	if i := slices.Index(k.buf, keyCtrlC); i >= 0 {
+		end = i
+	}
+	n := copy(p, k.buf[:end])
+	k.buf = k.buf[n:]
+	return n, nil
+}
+
+// interrupted report whether the line just read was cleared by Ctrl-C
+func (k *keyboard) interrupted() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.interrupts == 0 {
+		return false
+	}
+	k.interrupts--
+	return true
+}
+
+// interruptible derive a context cancelled by Ctrl-C until stop is called
+func (k *keyboard) interruptible(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	k.mu.Lock()
+	k.cancel = cancel
+	k.mu.Unlock()
+	return ctx, func() {
+		k.mu.Lock()
+		k.cancel = nil
+		k.mu.Unlock()
+		cancel()
+	}
+}
+
+// shell interactive SQL session on a single database
+type shell struct {
+	d1     cloudflared1.CloudflareD1
+	dbID   string
+	name   string
+	out    io.Writer
+	errOut io.Writer
+	// mode output format, changed by .mode
+	mode string
+	// timer print the meta of each query, changed by .timer
+	timer bool
+	// interactive input is a terminal, rather than a script
+	interactive bool
+	// keys input of the terminal, nil for scripts
+	keys *keyboard
+	// names tables and columns offered by tab completion
+	names []string
+	// failed a statement or command failed
+	failed bool
+}
+
+func runShell(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("shell")
+	historyPath := fs.String("history", defaultHistoryPath(), "`file` to keep the history of the shell in, empty to keep none")
+	args, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	d1, close, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer close()
+	dbID, err := d1.ResolveID(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	sh := &shell{d1: d1, dbID: dbID, name: args[0], out: a.stdout, errOut: a.stderr, mode: a.format}
+	if f, ok := a.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		return sh.runTerminal(ctx, f, a.stdout, *historyPath)
+	}
+	scanner := bufio.NewScanner(a.stdin)
+	// lines of SQL dumps may be far longer than the default limit
+	scanner.Buffer(nil, 64<<20)
+	if err := sh.loop(ctx, scriptReader{scanner}); err != nil {
+		return err
+	}
+	if sh.failed {
+		return errors.New("shell: one or more statements failed")
+	}
+	return nil
+}
+
+// runTerminal run the shell on a terminal, with line editing, history and completion
+func (sh *shell) runTerminal(ctx context.Context, in *os.File, out io.Writer, historyPath string) error {
+	fd := int(in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	// raw mode turns off SIGINT, so Ctrl-C is handled by keyboard
+	sh.keys = newKeyboard(in)
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{sh.keys, out}, "")
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		t.SetSize(width, height)
+	}
+	hist, err := openHistory(historyPath)
+	if err != nil {
+		fmt.Fprintf(t, "history unavailable: %s\n", err)
+	} else {
+		defer hist.Close()
+		t.History = hist
+	}
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return complete(line, pos, sh.names)
+	}
+	sh.out, sh.errOut, sh.interactive = t, t, true
+	sh.loadNames(ctx)
+	fmt.Fprintf(t, "Connected to %s. Enter \".help\" for usage hints.\n", sh.name)
+	return sh.loop(ctx, t)
+}
+
+// loop read lines until the input ends, Ctrl-D or .quit, running each dot-command and each complete statement as it is entered
+func (sh *shell) loop(ctx context.Context, in lineReader) error {
+	prompt := sh.name + "> "
+	continuation := strings.Repeat(" ", max(len(prompt)-5, 0)) + "...> "
+	var buf strings.Builder
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if buf.Len() == 0 {
+			in.SetPrompt(prompt)
+		} else {
+			in.SetPrompt(continuation)
+		}
+		line, err := in.ReadLine()
+		if errors.Is(err, io.EOF) {
+			// Ctrl-D on a terminal abandons the statement being entered, as it does in sqlite3
+			if !sh.interactive && strings.TrimSpace(buf.String()) != "" {
+				sh.exec(ctx, buf.String())
+			}
+			return nil
+		}
+		if err != nil && !errors.Is(err, term.ErrPasteIndicator) {
+			return err
+		}
+		if sh.keys != nil && sh.keys.interrupted() {
+			buf.Reset()
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if buf.Len() == 0 && strings.HasPrefix(trimmed, ".") {
+			if sh.command(ctx, trimmed) {
+				return nil
+			}
+			continue
+		}
+		if buf.Len() == 0 && trimmed == "" {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		if utils.IsComplete(buf.String()) {
+			sh.exec(ctx, buf.String())
+			buf.Reset()
+		}
+	}
+}
+
+// fail report an error, leaving the shell running
+func (sh *shell) fail(err error) {
+	sh.failed = true
+	fmt.Fprintln(sh.errOut, "Error:", err)
+}
+
+// exec run sql and print its results
+func (sh *shell) exec(ctx context.Context, sql string) {
+	if sh.keys != nil {
+		var stop func()
+		ctx, stop = sh.keys.interruptible(ctx)
+		defer stop()
+	}
+	res, err := check(sh.d1.QueryDBRaw(ctx, sh.dbID, sql))
+	if errors.Is(err, context.Canceled) {
+		err = errors.New("interrupted")
+	}
+	if err != nil {
+		sh.fail(err)
+		return
+	}
+	if err := writeResults(sh.out, sh.mode, res.Result, true); err != nil {
+		sh.fail(err)
+		return
+	}
+	if sh.timer {
+		writeTimer(sh.out, res.Result)
+	}
+	if sh.interactive && schemaChange.MatchString(sql) {
+		sh.loadNames(ctx)
+	}
+}
+
+// writeTimer print the duration, rows read and written and region of a query, summed over its statements
+func writeTimer(w io.Writer, results []cloudflared1.RawResult) {
+	var duration float64
+	var read, written int
+	var regions []string
+	for _, res := range results {
+		duration += res.Meta.Duration
+		read += res.Meta.RowsRead
+		written += res.Meta.RowsWritten
+		if region := res.Meta.ServedByRegion; region != "" && !slices.Contains(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	fmt.Fprintf(w, "Run Time: %.3fms, rows read: %d, rows written: %d, served by region: %s\n",
+		duration, read, written, strings.Join(regions, ","))
+}
+
+// command run a dot-command, reporting whether the shell should exit
+func (sh *shell) command(ctx context.Context, line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ".exit", ".quit":
+		return true
+	case ".help":
+		fmt.Fprint(sh.out, shellHelp)
+	case ".tables":
+		tables, _, err := cloudflared1.Query[string](ctx, sh.d1, sh.dbID,
+			"SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND "+userObjects+" ORDER BY name")
+		if err != nil {
+			sh.fail(err)
+			return false
+		}
+		for _, table := range tables {
+			fmt.Fprintln(sh.out, table)
+		}
+	case ".schema":
+		query := "SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND " + userObjects
+		var params []any
+		if len(fields) > 1 {
+			query += " AND tbl_name LIKE ?"
+			params = append(params, fields[1])
+		}
+		query += " ORDER BY tbl_name, type NOT IN ('table', 'view'), name"
+		schema, _, err := cloudflared1.Query[string](ctx, sh.d1, sh.dbID, query, params...)
+		if err != nil {
+			sh.fail(err)
+			return false
+		}
+		for _, sql := range schema {
+			fmt.Fprintln(sh.out, sql+";")
+		}
+	case ".mode":
+		switch {
+		case len(fields) == 1:
+			fmt.Fprintln(sh.out, sh.mode)
+		case slices.Contains(formats, fields[1]):
+			sh.mode = fields[1]
+		default:
+			sh.fail(fmt.Errorf("unknown mode %q, must be one of %s", fields[1], strings.Join(formats, ", ")))
+		}
+	case ".timer":
+		switch {
+		case len(fields) == 2 && fields[1] == "on":
+			sh.timer = true
+		case len(fields) == 2 && fields[1] == "off":
+			sh.timer = false
+		default:
+			sh.fail(errors.New("usage: .timer on|off"))
+		}
+	default:
+		sh.fail(fmt.Errorf("unknown command %s, enter \".help\" for usage hints", fields[0]))
+	}
+	return false
+}
+
+// loadNames gather the table and column names offered by tab completion from sqlite_master.
+// Completion is a convenience, so the previous names are kept if they cannot be read.
+func (sh *shell) loadNames(ctx context.Context) {
+	type column struct {
+		Table  string `d1:"tbl"`
+		Column string `d1:"col"`
+	}
+	columns, _, err := cloudflared1.Query[column](ctx, sh.d1, sh.dbID, `SELECT m.name AS tbl, p.name AS col
+FROM sqlite_master AS m, pragma_table_info(m.name) AS p
+WHERE m.type IN ('table', 'view') AND m.name NOT GLOB 'sqlite_*' AND m.name NOT GLOB '_cf_*'`)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, c := range columns {
+		names = append(names, c.Table, c.Column)
+	}
+	slices.Sort(names)
+	sh.names = slices.Compact(names)
+}
+
+// complete the word before pos in line to the longest prefix shared by the names starting with it,
+// ignoring case. It reports false when there is nothing to add.
+func complete(line string, pos int, names []string) (string, int, bool) {
+	start := pos
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+	word := line[start:pos]
+	if word == "" {
+		return "", 0, false
+	}
+	common := ""
+	for _, name := range names {
+		if len(name) < len(word) || !strings.EqualFold(name[:len(word)], word) {
+			continue
+		}
+		if common == "" {
+			common = name
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(name) && strings.EqualFold(common[n:n+1], name[n:n+1]) {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) <= len(word) {
+		return "", 0, false
+	}
+	return line[:start] + common + line[pos:], start + len(common), true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// defaultHistoryPath ~/.d1_history, or no history if the home directory is unknown
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".d1_history")
+}
+
+// history lines entered in the shell, held for term.Terminal and appended to a file so they
+// are available to later sessions
+type history struct {
+	// lines oldest first
+	lines []string
+	file  *os.File
+}
+
+// openHistory load the history kept in path, trimming the file to the most recent maxHistory lines.
+// An empty path keeps history in memory only.
+func openHistory(path string) (*history, error) {
+	h := &history{}
+	if path == "" {
+		return h, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+		if err := os.WriteFile(path, []byte(strings.Join(h.lines, "\n")+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	h.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Add record entry, unless it is blank or repeats the previous entry
+func (h *history) Add(entry string) {
+	if strings.TrimSpace(entry) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == entry) {
+		return
+	}
+	h.lines = append(h.lines, entry)
+	if len(h.lines) > maxHistory {
+		h.lines = slices.Delete(h.lines, 0, 1)
+	}
+	if h.file != nil {
+		fmt.Fprintln(h.file, entry)
+	}
+}
+
+func (h *history) Len() int {
+	return len(h.lines)
+}
+
+// At entry idx, counting back from the most recent
+func (h *history) At(idx int) string {
+	return h.lines[len(h.lines)-1-idx]
+}
+
+func (h *history) Close() error {
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
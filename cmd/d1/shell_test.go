@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/term"
+)
+
+func TestShellScript(t *testing.T) {
+	a, stdout := newApp(t)
+	run(t, a, stdout, "create", "shop")
+	a.stdin = strings.NewReader(`
+CREATE TABLE items (
+  id INTEGER PRIMARY KEY,
+  name TEXT
+);
+CREATE INDEX items_name ON items (name);
+INSERT INTO items (name) VALUES ('a;b'), ('c');
+.tables
+.schema items
+.mode csv
+SELECT * FROM items;
+.mode json
+.timer on
+SELECT id FROM items WHERE name = 'c';
+.timer off
+.mode
+SELECT 1 AS x`)
+	out := run(t, a, stdout, "shell", "shop")
+	timer := regexp.MustCompile(`Run Time: \d+\.\d{3}ms, rows read: 1, rows written: 0, served by region: mock-region\n`)
+	assert.Regexp(t, timer, out)
+	assert.Equal(t, `items
+CREATE TABLE items (
+  id INTEGER PRIMARY KEY,
+  name TEXT
+);
+CREATE INDEX items_name ON items (name);
+id,name
+1,a;b
+2,c
+[{"id":2}]
+json
+[{"x":1}]
+`, timer.ReplaceAllString(out, ""))
+}
+
+func TestShellErrors(t *testing.T) {
+	a, stdout := newApp(t)
+	run(t, a, stdout, "create", "shop")
+	var stderr bytes.Buffer
+	a.stderr = &stderr
+	a.stdin = strings.NewReader("SELECT * FROM missing;\n.mode xml\n.frobnicate\nSELECT 2 AS y;\n.quit\nSELECT 3;\n")
+	stdout.Reset()
+	err := a.run(context.Background(), []string{"shell", "shop"})
+	assert.ErrorContains(t, err, "statements failed")
+	assert.Equal(t, "y\n2\n", stdout.String())
+	assert.Contains(t, stderr.String(), "no such table: missing")
+	assert.Contains(t, stderr.String(), `unknown mode "xml"`)
+	assert.Contains(t, stderr.String(), "unknown command .frobnicate")
+}
+
+func TestShellCompletion(t *testing.T) {
+	ctx := context.Background()
+	m, err := mock.NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer m.Close()
+	created, err := m.CreateDB(ctx, "shop")
+	assert.NoError(t, err)
+	dbID := created.Result.UUID.String()
+	_, err = m.QueryDB(ctx, dbID, "CREATE TABLE items (id INTEGER, item_name TEXT); CREATE TABLE users (id INTEGER, email TEXT)")
+	assert.NoError(t, err)
+
+	sh := &shell{d1: m, dbID: dbID}
+	sh.loadNames(ctx)
+	assert.Equal(t, []string{"email", "id", "item_name", "items", "users"}, sh.names)
+
+	tests := []struct {
+		line    string
+		pos     int
+		want    string
+		wantPos int
+		ok      bool
+	}{
+		{"SELECT * FROM us", 16, "SELECT * FROM users", 19, true},
+		{"SELECT * FROM US WHERE", 16, "SELECT * FROM users WHERE", 19, true},
+		{"SELECT it", 9, "SELECT item", 11, true},
+		{"SELECT item", 11, "", 0, false},
+		{"SELECT e FROM users", 8, "SELECT email FROM users", 12, true},
+		{"SELECT ", 7, "", 0, false},
+		{"SELECT zz", 9, "", 0, false},
+	}
+	for _, tt := range tests {
+		got, pos, ok := complete(tt.line, tt.pos, sh.names)
+		assert.Equal(t, tt.ok, ok, tt.line)
+		assert.Equal(t, tt.want, got, tt.line)
+		assert.Equal(t, tt.wantPos, pos, tt.line)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, err := openHistory(path)
+	assert.NoError(t, err)
+	h.Add("SELECT 1;")
+	h.Add("SELECT 1;")
+	h.Add("  ")
+	h.Add(".tables")
+	assert.Equal(t, 2, h.Len())
+	assert.Equal(t, ".tables", h.At(0))
+	assert.Equal(t, "SELECT 1;", h.At(1))
+	assert.NoError(t, h.Close())
+
+	// history is kept between sessions, trimmed to the most recent lines
+	h, err = openHistory(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, h.Len())
+	assert.Equal(t, ".tables", h.At(0))
+	for i := range maxHistory {
+		h.Add(fmt.Sprintf("SELECT %d;", i))
+	}
+	assert.Equal(t, maxHistory, h.Len())
+	assert.NoError(t, h.Close())
+	h, err = openHistory(path)
+	assert.NoError(t, err)
+	defer h.Close()
+	assert.Equal(t, maxHistory, h.Len())
+	assert.Equal(t, "SELECT 0;", h.At(maxHistory-1))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, maxHistory, strings.Count(string(data), "\n"))
+}
+
+func TestShellCtrlC(t *testing.T) {
+	ctx := context.Background()
+	m, err := mock.NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer m.Close()
+	created, err := m.CreateDB(ctx, "shop")
+	assert.NoError(t, err)
+
+	// Ctrl-C discards the statement being entered, and Ctrl-D on an empty line exits
+	r, w := io.Pipe()
+	var out bytes.Buffer
+	sh := &shell{d1: m, dbID: created.Result.UUID.String(), name: "shop", mode: "csv", interactive: true, keys: newKeyboard(r)}
+	tm := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{sh.keys, &out}, "")
+	sh.out, sh.errOut = tm, tm
+	done := make(chan error)
+	go func() { done <- sh.loop(ctx, tm) }()
+	_, err = io.WriteString(w, "SELECT 'lost' AS x\r\x03SELECT 'half\x03SELECT 'kept' AS x;\r\x04")
+	assert.NoError(t, err)
+	assert.NoError(t, <-done)
+	assert.False(t, sh.failed, out.String())
+	assert.Contains(t, out.String(), "kept")
+	assert.NotContains(t, out.String(), "lost\r\n")
+
+	// Ctrl-C while a query runs cancels it rather than clearing a line
+	qctx, stop := sh.keys.interruptible(ctx)
+	_, err = io.WriteString(w, "\x03")
+	assert.NoError(t, err)
+	<-qctx.Done()
+	stop()
+	assert.False(t, sh.keys.interrupted())
+	w.Close()
+}
@@ -0,0 +1,319 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+)
+
+var (
+	// ErrReadInTx reads cannot be performed inside a transaction, which is sent as a single batch on commit
+	ErrReadInTx = errors.New("d1: queries are not supported inside a transaction; statements are only executed on commit")
+	// ErrResultPending the result of a statement in a transaction is not known until the transaction commits
+	ErrResultPending = errors.New("d1: result is not available until the transaction commits")
+	// ErrTxDone the transaction has already been committed or rolled back
+	ErrTxDone = errors.New("d1: transaction has already been committed or rolled back")
+)
+
+// conn connection to a D1 database. Each statement is sent as its own HTTP request.
+type conn struct {
+	d1   cloudflared1.CloudflareD1
+	dbID string
+	// tx active transaction buffering statements, if any
+	tx *tx
+}
+
+var (
+	_ driver.Conn               = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.NamedValueChecker  = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext statements are not prepared server side, so this only records the query
+func (c *conn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	c.tx = nil
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx start buffering statements to be sent as a batch on commit
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("d1: transaction already in progress")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("d1: read only transactions are not supported")
+	}
+	if sql.IsolationLevel(opts.Isolation) != sql.LevelDefault && sql.IsolationLevel(opts.Isolation) != sql.LevelSerializable {
+		return nil, fmt.Errorf("d1: isolation level %s is not supported", sql.IsolationLevel(opts.Isolation))
+	}
+	c.tx = &tx{ctx: ctx, conn: c}
+	return c.tx, nil
+}
+
+// Ping check the database is reachable
+func (c *conn) Ping(ctx context.Context) error {
+	res, err := c.d1.GetDB(ctx, c.dbID)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// CheckNamedValue only positional parameters are supported by D1
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nv.Name != "" {
+		return fmt.Errorf("d1: named parameter %q is not supported, use ?NNN placeholders", nv.Name)
+	}
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = value
+	return nil
+}
+
+// ExecContext execute a statement, or buffer it if a transaction is in progress
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	params := toParams(args)
+	if c.tx != nil {
+		c.tx.statements = append(c.tx.statements, cloudflared1.Statement{SQL: query, Params: params})
+		return pendingResult{}, nil
+	}
+	res, err := c.d1.QueryDB(ctx, c.dbID, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	return newResult(res.Result), nil
+}
+
+// QueryContext execute a query through the raw endpoint, preserving column order
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.tx != nil {
+		return nil, ErrReadInTx
+	}
+	res, err := c.d1.QueryDBRaw(ctx, c.dbID, query, toParams(args)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	if len(res.Result) == 0 {
+		return &rows{}, nil
+	}
+	// rows of multi statement queries come from the last statement
+	raw := res.Result[len(res.Result)-1]
+	return &rows{columns: raw.Columns, values: raw.Rows}, nil
+}
+
+// toParams convert driver arguments into D1 query parameters. []byte values are left for
+// client.Client to encode as blobs.
+func toParams(args []driver.NamedValue) []any {
+	params := make([]any, len(args))
+	for i, arg := range args {
+		params[i] = arg.Value
+	}
+	return params
+}
+
+// stmt query recorded by Prepare, executed each time it is used
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+var (
+	_ driver.Stmt             = (*stmt)(nil)
+	_ driver.StmtExecContext  = (*stmt)(nil)
+	_ driver.StmtQueryContext = (*stmt)(nil)
+)
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput the number of placeholders is not known without parsing the query
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), toNamedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), toNamedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func toNamedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// rows result set built from the raw endpoint's columns and rows
+type rows struct {
+	columns []string
+	values  [][]any
+	pos     int
+}
+
+var _ driver.Rows = (*rows)(nil)
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	r.pos = len(r.values)
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	row := r.values[r.pos]
+	r.pos++
+	for i := range dest {
+		if i >= len(row) {
+			dest[i] = nil
+			continue
+		}
+		v, err := toDriverValue(row[i])
+		if err != nil {
+			return err
+		}
+		dest[i] = v
+	}
+	return nil
+}
+
+// toDriverValue convert values decoded from JSON into driver values.
+// Integers arrive as float64 and blobs as arrays of numbers, each of which must be a byte.
+func toDriverValue(v any) (driver.Value, error) {
+	switch val := v.(type) {
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return int64(val), nil
+		}
+		return val, nil
+	case []any:
+		b := make([]byte, len(val))
+		for i, item := range val {
+			n, ok := item.(float64)
+			if !ok || n != math.Trunc(n) || n < 0 || n > 255 {
+				return nil, fmt.Errorf("d1: invalid blob, element %d is %v rather than a byte", i, item)
+			}
+			b[i] = byte(n)
+		}
+		return b, nil
+	case nil, int64, bool, string, []byte:
+		return val, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// result outcome of a statement. Changes are summed over every statement in the query,
+// and the last row id is taken from the last statement.
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func newResult(results []cloudflared1.QueryResult[any]) driver.Result {
+	r := result{}
+	for _, res := range results {
+		r.rowsAffected += int64(res.Meta.Changes)
+		r.lastInsertID = res.Meta.LastRowID
+	}
+	return r
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// pendingResult result of a statement buffered in a transaction
+type pendingResult struct{}
+
+func (pendingResult) LastInsertId() (int64, error) {
+	return 0, ErrResultPending
+}
+
+func (pendingResult) RowsAffected() (int64, error) {
+	return 0, ErrResultPending
+}
+
+// tx buffers statements and sends them as a single atomic batch on commit
+type tx struct {
+	// ctx of BeginTx, which the commit is bound to
+	ctx        context.Context
+	conn       *conn
+	statements []cloudflared1.Statement
+}
+
+var _ driver.Tx = (*tx)(nil)
+
+func (t *tx) Commit() error {
+	if t.conn.tx != t {
+		return ErrTxDone
+	}
+	t.conn.tx = nil
+	if len(t.statements) == 0 {
+		return nil
+	}
+	res, err := t.conn.d1.BatchQuery(t.ctx, t.conn.dbID, t.statements)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+func (t *tx) Rollback() error {
+	if t.conn.tx != t {
+		return ErrTxDone
+	}
+	t.conn.tx = nil
+	t.statements = nil
+	return nil
+}
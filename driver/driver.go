@@ -0,0 +1,148 @@
+// Package driver registers a "d1" database/sql driver backed by the D1 REST API.
+//
+// The DSN has the form
+//
+//	d1://<account_id>:<api_token>@<database_id or name>[?base_url=<url>]
+//
+// Statements are sent individually through QueryDB and QueryDBRaw. Transactions buffer their
+// statements and commit them as one atomic batch, so reads inside a transaction are not supported.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/client"
+)
+
+// DriverName name the driver is registered under with database/sql
+const DriverName = "d1"
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+// Driver database/sql driver for Cloudflare D1
+type Driver struct{}
+
+var (
+	_ driver.Driver        = (*Driver)(nil)
+	_ driver.DriverContext = (*Driver)(nil)
+)
+
+// Open a connection using a DSN. Prefer sql.Open, which calls OpenConnector.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+// OpenConnector parse the DSN and create a connector for the database it names
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	var opts []client.Option
+	if cfg.BaseURL != "" {
+		opts = append(opts, client.WithBaseURL(cfg.BaseURL))
+	}
+	c, err := client.NewClient(cfg.AccountID, cfg.APIToken, opts...)
+	if err != nil {
+		return nil, err
+	}
+	connector := NewConnector(c, cfg.Database)
+	connector.driver = d
+	return connector, nil
+}
+
+// Config settings parsed from a DSN
+type Config struct {
+	AccountID string
+	APIToken  string
+	// Database ID or name of the database
+	Database string
+	// BaseURL root of the cloudflare API, if not the default
+	BaseURL string
+}
+
+// ParseDSN parse a DSN of the form d1://<account_id>:<api_token>@<database>[?base_url=<url>]
+func ParseDSN(dsn string) (Config, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return Config{}, fmt.Errorf("d1: invalid dsn: %w", err)
+	}
+	if u.Scheme != DriverName {
+		return Config{}, fmt.Errorf("d1: invalid dsn scheme %q", u.Scheme)
+	}
+	token, _ := u.User.Password()
+	cfg := Config{
+		AccountID: u.User.Username(),
+		APIToken:  token,
+		Database:  u.Host + strings.TrimSuffix(u.Path, "/"),
+		BaseURL:   u.Query().Get("base_url"),
+	}
+	if cfg.AccountID == "" || cfg.APIToken == "" || cfg.Database == "" {
+		return Config{}, errors.New("d1: dsn requires an account id, api token and database")
+	}
+	return cfg, nil
+}
+
+// Connector creates connections to a single D1 database.
+// Use NewConnector with sql.OpenDB to connect through any CloudflareD1 implementation, such as the mock.
+type Connector struct {
+	d1       cloudflared1.CloudflareD1
+	database string
+	driver   driver.Driver
+
+	mu   sync.Mutex
+	dbID string
+}
+
+var _ driver.Connector = (*Connector)(nil)
+
+// NewConnector create a connector for the database with the given ID or name
+func NewConnector(d1 cloudflared1.CloudflareD1, database string) *Connector {
+	return &Connector{
+		d1:       d1,
+		database: database,
+		driver:   &Driver{},
+	}
+}
+
+// Connect resolve the database and return a connection to it
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dbID, err := c.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{d1: c.d1, dbID: dbID}, nil
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// resolve look up the database ID, which may be given by name
+func (c *Connector) resolve(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dbID != "" {
+		return c.dbID, nil
+	}
+	dbID, err := c.d1.ResolveID(ctx, c.database)
+	if err != nil {
+		return "", err
+	}
+	c.dbID = dbID
+	return c.dbID, nil
+}
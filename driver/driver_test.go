@@ -0,0 +1,197 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crosleyzack/cloudflare-d1-go/fakeserver"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	client, err := mock.NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	_, err = client.CreateDB(context.Background(), "driver")
+	assert.NoError(t, err)
+	// resolve the database by name
+	db := sql.OpenDB(NewConnector(client, "driver"))
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE, score REAL, data BLOB)")
+	assert.NoError(t, err)
+	return db
+}
+
+func TestParseDSN(t *testing.T) {
+	cfg, err := ParseDSN("d1://account:tok%2Fen@my-db?base_url=http://localhost:8787")
+	assert.NoError(t, err)
+	assert.Equal(t, Config{
+		AccountID: "account",
+		APIToken:  "tok/en",
+		Database:  "my-db",
+		BaseURL:   "http://localhost:8787",
+	}, cfg)
+
+	_, err = ParseDSN("postgres://account:token@db")
+	assert.Error(t, err)
+	_, err = ParseDSN("d1://account@db")
+	assert.Error(t, err)
+	_, err = ParseDSN("d1://account:token@")
+	assert.Error(t, err)
+}
+
+func TestOpen(t *testing.T) {
+	db, err := sql.Open(DriverName, "d1://account:token@00000000-0000-0000-0000-000000000000")
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	_, err = sql.Open(DriverName, "d1://invalid")
+	assert.Error(t, err)
+}
+
+func TestExecQuery(t *testing.T) {
+	db := newTestDB(t)
+
+	res, err := db.Exec("INSERT INTO users (name, score, data) VALUES (?, ?, ?)", "alice", 1.5, []byte("hi"))
+	assert.NoError(t, err)
+	id, err := res.LastInsertId()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, id)
+	affected, err := res.RowsAffected()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, affected)
+
+	_, err = db.Exec("INSERT INTO users (name, score) VALUES (?, ?)", "bob", 2)
+	assert.NoError(t, err)
+
+	// constraint violations are returned as errors
+	_, err = db.Exec("INSERT INTO users (name) VALUES (?)", "bob")
+	assert.Error(t, err)
+
+	rows, err := db.Query("SELECT id, name, score FROM users ORDER BY id")
+	assert.NoError(t, err)
+	defer rows.Close()
+	columns, err := rows.Columns()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "name", "score"}, columns)
+	var names []string
+	for rows.Next() {
+		var (
+			id    int
+			name  string
+			score float64
+		)
+		assert.NoError(t, rows.Scan(&id, &name, &score))
+		names = append(names, name)
+	}
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, []string{"alice", "bob"}, names)
+
+	var count int
+	assert.NoError(t, db.QueryRow("SELECT count(*) FROM users WHERE score > ?", 1).Scan(&count))
+	assert.Equal(t, 2, count)
+
+	// prepared statements
+	stmt, err := db.Prepare("SELECT name FROM users WHERE id = ?")
+	assert.NoError(t, err)
+	defer stmt.Close()
+	var name string
+	assert.NoError(t, stmt.QueryRow(2).Scan(&name))
+	assert.Equal(t, "bob", name)
+
+	// named parameters are rejected
+	_, err = db.Exec("INSERT INTO users (name) VALUES (:name)", sql.Named("name", "carol"))
+	assert.Error(t, err)
+
+	assert.NoError(t, db.Ping())
+}
+
+func TestTx(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// committed statements are applied together
+	tx, err := db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	res, err := tx.Exec("INSERT INTO users (name) VALUES (?)", "alice")
+	assert.NoError(t, err)
+	_, err = res.LastInsertId()
+	assert.ErrorIs(t, err, ErrResultPending)
+	_, err = tx.Exec("INSERT INTO users (name) VALUES (?)", "bob")
+	assert.NoError(t, err)
+	// reads are not possible until the batch is sent
+	_, err = tx.Query("SELECT * FROM users")
+	assert.ErrorIs(t, err, ErrReadInTx)
+	assert.NoError(t, tx.Commit())
+
+	var count int
+	assert.NoError(t, db.QueryRow("SELECT count(*) FROM users").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	// rolled back statements are never sent
+	tx, err = db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	_, err = tx.Exec("INSERT INTO users (name) VALUES (?)", "carol")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback())
+
+	// failing batches are not applied
+	tx, err = db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	_, err = tx.Exec("INSERT INTO users (name) VALUES (?)", "dave")
+	assert.NoError(t, err)
+	_, err = tx.Exec("INSERT INTO users (name) VALUES (?)", "alice")
+	assert.NoError(t, err)
+	assert.Error(t, tx.Commit())
+
+	assert.NoError(t, db.QueryRow("SELECT count(*) FROM users").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	// read only transactions are not supported
+	_, err = db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	assert.Error(t, err)
+}
+
+func TestBlobRoundTrip(t *testing.T) {
+	// through client.Client and the fake server, so blobs are JSON encoded as they are for D1
+	m, err := mock.NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { m.Close() })
+	_, err = m.CreateDB(context.Background(), "blobs")
+	assert.NoError(t, err)
+	server := httptest.NewServer(fakeserver.New(m))
+	t.Cleanup(server.Close)
+	db, err := sql.Open(DriverName, "d1://account:token@blobs?base_url="+server.URL)
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec("CREATE TABLE files (data BLOB)")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO files (data) VALUES (?)", []byte{0, 'h', 'i', 255})
+	assert.NoError(t, err)
+	var (
+		kind string
+		data []byte
+	)
+	assert.NoError(t, db.QueryRow("SELECT typeof(data), data FROM files").Scan(&kind, &data))
+	assert.Equal(t, "blob", kind)
+	assert.Equal(t, []byte{0, 'h', 'i', 255}, data)
+}
+
+func TestToDriverValue(t *testing.T) {
+	v, err := toDriverValue([]any{float64(0), float64(104), float64(255)})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 'h', 255}, v)
+	v, err = toDriverValue(float64(3))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+
+	// blobs of anything but bytes are an error rather than zeroes
+	for _, blob := range [][]any{{float64(256)}, {float64(-1)}, {float64(1.5)}, {"a"}, {nil}} {
+		_, err := toDriverValue(blob)
+		assert.Error(t, err, blob)
+	}
+}
@@ -0,0 +1,59 @@
+package cloudflared1
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+// DefaultPollInterval how often the status of an asynchronous export or import is checked
+const DefaultPollInterval = time.Second
+
+// Exporter is implemented by clients which can dump a database as SQL.
+// https://developers.cloudflare.com/d1/best-practices/import-export-data/
+type Exporter interface {
+	// Export write a SQL dump of the database to w, returning the completed export operation
+	Export(ctx context.Context, dbID string, w io.Writer, opts ExportOptions) (*utils.APIResponse[ExportOperation], error)
+}
+
+// ExportOptions controls what is included in an export and how it is reported
+type ExportOptions struct {
+	// NoData export only the schema
+	NoData bool `json:"no_data,omitempty"`
+	// NoSchema export only the rows, as INSERT statements
+	NoSchema bool `json:"no_schema,omitempty"`
+	// Tables limit the export to these tables, all tables are exported when empty
+	Tables []string `json:"tables,omitempty"`
+	// PollInterval how often to check whether the export is ready, DefaultPollInterval if zero
+	PollInterval time.Duration `json:"-"`
+	// Progress called as the dump is written to w, if not nil
+	Progress utils.ProgressFunc `json:"-"`
+}
+
+// Status of an asynchronous export or import operation
+const (
+	OperationActive   = "active"
+	OperationComplete = "complete"
+	OperationError    = "error"
+)
+
+// ExportOperation state of an asynchronous export
+type ExportOperation struct {
+	// AtBookmark point in the database history being exported, used to poll the export
+	AtBookmark string   `json:"at_bookmark"`
+	Error      string   `json:"error,omitempty"`
+	Messages   []string `json:"messages,omitempty"`
+	// Result location of the dump once Status is complete
+	Result  *ExportFile `json:"result,omitempty"`
+	Status  string      `json:"status"`
+	Success bool        `json:"success"`
+	Type    string      `json:"type"`
+}
+
+// ExportFile a completed SQL dump, downloadable from SignedURL for a limited time
+type ExportFile struct {
+	Filename  string `json:"filename"`
+	SignedURL string `json:"signed_url"`
+}
@@ -0,0 +1,453 @@
+package fakeserver
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+// decode read a JSON request body into v, writing an error response if it is invalid.
+// Numbers are decoded as int64 where possible so integer parameters keep their type.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, 7400, fmt.Sprintf("Invalid request body: %s", err))
+		return false
+	}
+	return true
+}
+
+// params convert JSON decoded query parameters into values sqlite can bind.
+// Blobs arrive as arrays of numbers, as D1 encodes them.
+func params(in []any) []any {
+	out := make([]any, len(in))
+	for i, p := range in {
+		switch v := p.(type) {
+		case json.Number:
+			out[i] = number(v)
+		case []any:
+			if b, ok := toBlob(v); ok {
+				out[i] = b
+			} else {
+				out[i] = p
+			}
+		default:
+			out[i] = p
+		}
+	}
+	return out
+}
+
+// number convert a JSON number to an int64 where possible, then a float64
+func number(n json.Number) any {
+	if v, err := n.Int64(); err == nil {
+		return v
+	}
+	if v, err := n.Float64(); err == nil {
+		return v
+	}
+	return n.String()
+}
+
+// toBlob convert an array of byte values into a blob
+func toBlob(in []any) ([]byte, bool) {
+	b := make([]byte, len(in))
+	for i, item := range in {
+		n, ok := item.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		v, err := n.Int64()
+		if err != nil || v < 0 || v > 255 {
+			return nil, false
+		}
+		b[i] = byte(v)
+	}
+	return b, true
+}
+
+// fromBlob encode a blob value the way D1 does, as an array of numbers rather than the
+// base64 string encoding/json would produce. Queries are run under mock.KeepBlobs so blobs
+// reach it as []byte.
+func fromBlob(v any) any {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	out := make([]int, len(b))
+	for i, c := range b {
+		out[i] = int(c)
+	}
+	return out
+}
+
+// encodeBlobs convert the blobs in the rows of query results for JSON
+func encodeBlobs(res *utils.APIResponse[[]cloudflared1.QueryResult[any]]) {
+	if res == nil {
+		return
+	}
+	for _, result := range res.Result {
+		rows, _ := result.Results.([]any)
+		for _, row := range rows {
+			if values, ok := row.(map[string]any); ok {
+				for col, v := range values {
+					values[col] = fromBlob(v)
+				}
+			}
+		}
+	}
+}
+
+// encodeRawBlobs convert the blobs in the rows of raw results for JSON
+func encodeRawBlobs(res *utils.APIResponse[[]cloudflared1.RawResult]) {
+	if res == nil {
+		return
+	}
+	for _, result := range res.Result {
+		for _, row := range result.Rows {
+			for i, v := range row {
+				row[i] = fromBlob(v)
+			}
+		}
+	}
+}
+
+// signedURL absolute url of path on this server, as seen by the client
+func signedURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, path)
+}
+
+func (s *Server) createDB(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+		cloudflared1.CreateDBOptions
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+	if body.Name == "" {
+		writeError(w, http.StatusBadRequest, 7400, "The request is malformed: name is required")
+		return
+	}
+	res, err := s.d1.CreateDBWithOptions(r.Context(), body.Name, body.CreateDBOptions)
+	writeResponse(w, res, err)
+}
+
+func (s *Server) listDB(w http.ResponseWriter, r *http.Request) {
+	var opts []cloudflared1.ListDBOption
+	query := r.URL.Query()
+	if name := query.Get("name"); name != "" {
+		opts = append(opts, cloudflared1.ListByName(name))
+	}
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		opts = append(opts, cloudflared1.ListPage(page))
+	}
+	if perPage, err := strconv.Atoi(query.Get("per_page")); err == nil && perPage > 0 {
+		opts = append(opts, cloudflared1.ListPerPage(perPage))
+	}
+	res, err := s.d1.ListDB(r.Context(), opts...)
+	writeResponse(w, res, err)
+}
+
+func (s *Server) getDB(w http.ResponseWriter, r *http.Request) {
+	res, err := s.d1.GetDB(r.Context(), r.PathValue("db"))
+	writeResponse(w, res, err)
+}
+
+func (s *Server) deleteDB(w http.ResponseWriter, r *http.Request) {
+	dbID := r.PathValue("db")
+	if _, err := s.d1.GetDB(r.Context(), dbID); err != nil {
+		writeResponse[cloudflared1.DeleteResult](w, nil, err)
+		return
+	}
+	res, err := s.d1.DeleteDB(r.Context(), dbID)
+	writeResponse(w, res, err)
+}
+
+func (s *Server) updateDB(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ReadReplication cloudflared1.ReadReplication `json:"read_replication"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+	res, err := s.d1.UpdateDB(r.Context(), r.PathValue("db"), cloudflared1.DBSettings{
+		Replication: body.ReadReplication.Mode,
+	})
+	writeResponse(w, res, err)
+}
+
+// queryBody request body of the query and raw endpoints, holding either one query or a batch
+type queryBody struct {
+	SQL    string `json:"sql"`
+	Params []any  `json:"params"`
+	Batch  []struct {
+		SQL    string `json:"sql"`
+		Params []any  `json:"params"`
+	} `json:"batch"`
+}
+
+// statements of the batch, with their parameters converted for sqlite
+func (b queryBody) statements() []cloudflared1.Statement {
+	statements := make([]cloudflared1.Statement, len(b.Batch))
+	for i, stmt := range b.Batch {
+		statements[i] = cloudflared1.Statement{SQL: stmt.SQL, Params: params(stmt.Params)}
+	}
+	return statements
+}
+
+func (s *Server) query(w http.ResponseWriter, r *http.Request) {
+	var body queryBody
+	if !decode(w, r, &body) {
+		return
+	}
+	if len(body.Batch) == 0 {
+		res, err := s.d1.QueryDB(mock.KeepBlobs(r.Context()), r.PathValue("db"), body.SQL, params(body.Params)...)
+		encodeBlobs(res)
+		writeResponse(w, res, err)
+		return
+	}
+	res, err := s.d1.BatchQuery(mock.KeepBlobs(r.Context()), r.PathValue("db"), body.statements())
+	encodeBlobs(res)
+	writeResponse(w, res, err)
+}
+
+func (s *Server) raw(w http.ResponseWriter, r *http.Request) {
+	var body queryBody
+	if !decode(w, r, &body) {
+		return
+	}
+	if len(body.Batch) == 0 {
+		res, err := s.d1.QueryDBRaw(mock.KeepBlobs(r.Context()), r.PathValue("db"), body.SQL, params(body.Params)...)
+		encodeRawBlobs(res)
+		writeResponse(w, res, err)
+		return
+	}
+	res, err := s.d1.BatchQueryRaw(mock.KeepBlobs(r.Context()), r.PathValue("db"), body.statements())
+	encodeRawBlobs(res)
+	writeResponse(w, res, err)
+}
+
+// timestamp parse the timestamp query parameter, as RFC3339 or unix seconds
+func timestamp(r *http.Request) (time.Time, bool, error) {
+	value := r.URL.Query().Get("timestamp")
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, true, err
+}
+
+func (s *Server) bookmark(w http.ResponseWriter, r *http.Request) {
+	at, ok, err := timestamp(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, 7400, fmt.Sprintf("Invalid timestamp: %s", err))
+		return
+	}
+	if !ok {
+		res, err := s.d1.GetBookmark(r.Context(), r.PathValue("db"))
+		writeResponse(w, res, err)
+		return
+	}
+	// timestamps only have second precision, so include the whole second
+	res, err := s.d1.GetBookmarkAt(r.Context(), r.PathValue("db"), at.Add(time.Second-time.Nanosecond))
+	writeResponse(w, res, err)
+}
+
+func (s *Server) restore(w http.ResponseWriter, r *http.Request) {
+	if bookmark := r.URL.Query().Get("bookmark"); bookmark != "" {
+		res, err := s.d1.RestoreBookmark(r.Context(), r.PathValue("db"), bookmark)
+		writeResponse(w, res, err)
+		return
+	}
+	at, ok, err := timestamp(r)
+	if err != nil || !ok {
+		writeError(w, http.StatusBadRequest, 7400, "A bookmark or timestamp is required")
+		return
+	}
+	res, err := s.d1.RestoreTimestamp(r.Context(), r.PathValue("db"), at.Add(time.Second-time.Nanosecond))
+	writeResponse(w, res, err)
+}
+
+// exportKey identifies a pending export. Exports of other databases, or with other dump
+// options, at the same bookmark are kept apart.
+type exportKey struct {
+	dbID     string
+	bookmark string
+	// options digest of the dump options
+	options string
+}
+
+// newExportKey key of an export of dbID at bookmark with opts
+func newExportKey(dbID, bookmark string, opts cloudflared1.ExportOptions) exportKey {
+	data, _ := json.Marshal(opts)
+	sum := md5.Sum(data)
+	return exportKey{dbID: dbID, bookmark: bookmark, options: hex.EncodeToString(sum[:])}
+}
+
+// path of the signed url an export is downloaded from
+func (k exportKey) path() string {
+	return "/exports/" + k.dbID + "/" + k.bookmark + "/" + k.options
+}
+
+// export dump the database when the export is started, reporting it as active, and hand out
+// the download url when it is polled so clients exercise the polling flow.
+func (s *Server) export(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DumpOptions     cloudflared1.ExportOptions `json:"dump_options"`
+		CurrentBookmark string                     `json:"current_bookmark"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+	if body.CurrentBookmark != "" {
+		key := newExportKey(r.PathValue("db"), body.CurrentBookmark, body.DumpOptions)
+		s.mu.Lock()
+		_, ok := s.exports[key]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusBadRequest, 7400, "No export in progress at bookmark "+body.CurrentBookmark)
+			return
+		}
+		writeResponse(w, &utils.APIResponse[cloudflared1.ExportOperation]{
+			Result: cloudflared1.ExportOperation{
+				AtBookmark: body.CurrentBookmark,
+				Result: &cloudflared1.ExportFile{
+					Filename:  body.CurrentBookmark + ".sql",
+					SignedURL: signedURL(r, key.path()),
+				},
+				Status:  cloudflared1.OperationComplete,
+				Success: true,
+				Type:    "export",
+			},
+			Success: true,
+		}, nil)
+		return
+	}
+	var dump bytes.Buffer
+	res, err := s.d1.Export(r.Context(), r.PathValue("db"), &dump, body.DumpOptions)
+	if err != nil {
+		writeResponse(w, res, err)
+		return
+	}
+	s.mu.Lock()
+	s.exports[newExportKey(r.PathValue("db"), res.Result.AtBookmark, body.DumpOptions)] = dump.Bytes()
+	s.mu.Unlock()
+	res.Result.Status = cloudflared1.OperationActive
+	res.Result.Result = nil
+	writeResponse(w, res, nil)
+}
+
+// download serve an export once, then drop it so dumps are not kept for the life of the server
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	key := exportKey{dbID: r.PathValue("db"), bookmark: r.PathValue("bookmark"), options: r.PathValue("options")}
+	s.mu.Lock()
+	dump, ok := s.exports[key]
+	delete(s.exports, key)
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/sql")
+	w.Header().Set("Content-Length", strconv.Itoa(len(dump)))
+	w.Write(dump)
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.uploads[r.PathValue("filename")] = data
+	s.mu.Unlock()
+	sum := md5.Sum(data)
+	w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(sum[:])))
+}
+
+// importSQL run the init, ingest and poll actions of an import. The file is executed on
+// ingest, and the outcome reported when polled.
+func (s *Server) importSQL(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Action          string `json:"action"`
+		Etag            string `json:"etag"`
+		Filename        string `json:"filename"`
+		CurrentBookmark string `json:"current_bookmark"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+	switch body.Action {
+	case "init":
+		filename := body.Etag + ".sql"
+		writeResponse(w, &utils.APIResponse[cloudflared1.ImportOperation]{
+			Result: cloudflared1.ImportOperation{
+				Filename:  filename,
+				Success:   true,
+				UploadURL: signedURL(r, "/uploads/"+filename),
+			},
+			Success: true,
+		}, nil)
+	case "ingest":
+		s.mu.Lock()
+		data, ok := s.uploads[body.Filename]
+		delete(s.uploads, body.Filename)
+		s.mu.Unlock()
+		sum := md5.Sum(data)
+		if !ok || hex.EncodeToString(sum[:]) != body.Etag {
+			writeError(w, http.StatusBadRequest, 7400, "No upload found matching filename and etag")
+			return
+		}
+		// failures are reported by the poll rather than the ingest
+		res, err := s.d1.ImportSQL(r.Context(), r.PathValue("db"), bytes.NewReader(data), cloudflared1.ImportOptions{})
+		if res == nil {
+			writeResponse(w, res, err)
+			return
+		}
+		s.mu.Lock()
+		s.imports[res.Result.AtBookmark] = res.Result
+		s.mu.Unlock()
+		writeResponse(w, &utils.APIResponse[cloudflared1.ImportOperation]{
+			Result: cloudflared1.ImportOperation{
+				AtBookmark: res.Result.AtBookmark,
+				Filename:   body.Filename,
+				Status:     cloudflared1.OperationActive,
+				Success:    true,
+				Type:       "import",
+			},
+			Success: true,
+		}, nil)
+	case "poll":
+		s.mu.Lock()
+		op, ok := s.imports[body.CurrentBookmark]
+		delete(s.imports, body.CurrentBookmark)
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusBadRequest, 7400, "Not currently importing anything.")
+			return
+		}
+		writeResponse(w, &utils.APIResponse[cloudflared1.ImportOperation]{Result: op, Success: true}, nil)
+	default:
+		writeError(w, http.StatusBadRequest, 7400, fmt.Sprintf("Unknown import action %q", body.Action))
+	}
+}
@@ -0,0 +1,211 @@
+// Package fakeserver serves the Cloudflare D1 REST API over HTTP, backed by the sqlite databases of a
+// mock.MockClient. It lets client.Client, or any other HTTP client, be exercised end to end:
+//
+//	m, _ := mock.NewMockClient(t.TempDir())
+//	server := httptest.NewServer(fakeserver.New(m))
+//	c, _ := client.NewClient("account", "token", client.WithBaseURL(server.URL))
+package fakeserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+// apiPrefix path prefix of the real cloudflare API, which is accepted but not required
+const apiPrefix = "/client/v4"
+
+// Server http.Handler speaking the D1 REST API. It is safe for concurrent use.
+type Server struct {
+	d1 *mock.MockClient
+	// tokens accepted bearer tokens, any token is accepted when empty
+	tokens map[string]bool
+	// accounts accepted account IDs, any account is accepted when empty
+	accounts map[string]bool
+	logger   *slog.Logger
+	mux      *http.ServeMux
+
+	// mu guards exports, uploads and imports
+	mu sync.Mutex
+	// exports SQL dumps by database, bookmark and dump options, downloadable once after the
+	// export has been polled
+	exports map[exportKey][]byte
+	// uploads SQL files by filename, awaiting ingest
+	uploads map[string][]byte
+	// imports finished imports by bookmark, reported when polled
+	imports map[string]cloudflared1.ImportOperation
+}
+
+// Option configures optional settings on a Server
+type Option func(*Server)
+
+// WithTokens only accept requests bearing one of tokens
+func WithTokens(tokens ...string) Option {
+	return func(s *Server) {
+		for _, token := range tokens {
+			s.tokens[token] = true
+		}
+	}
+}
+
+// WithAccountIDs only accept requests for one of accountIDs
+func WithAccountIDs(accountIDs ...string) Option {
+	return func(s *Server) {
+		for _, id := range accountIDs {
+			s.accounts[id] = true
+		}
+	}
+}
+
+// WithLogger log each request handled, with its status and duration, at info level
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// New create a server backed by the databases of d1
+func New(d1 *mock.MockClient, opts ...Option) *Server {
+	s := &Server{
+		d1:       d1,
+		tokens:   map[string]bool{},
+		accounts: map[string]bool{},
+		mux:      http.NewServeMux(),
+		exports:  map[exportKey][]byte{},
+		uploads:  map[string][]byte{},
+		imports:  map[string]cloudflared1.ImportOperation{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.routes()
+	return s
+}
+
+func (s *Server) routes() {
+	const db = "/accounts/{account}/d1/database/{db}"
+	s.mux.Handle("POST /accounts/{account}/d1/database", s.auth(s.createDB))
+	s.mux.Handle("GET /accounts/{account}/d1/database", s.auth(s.listDB))
+	s.mux.Handle("GET "+db, s.auth(s.getDB))
+	s.mux.Handle("DELETE "+db, s.auth(s.deleteDB))
+	s.mux.Handle("PATCH "+db, s.auth(s.updateDB))
+	s.mux.Handle("POST "+db+"/query", s.auth(s.query))
+	s.mux.Handle("POST "+db+"/raw", s.auth(s.raw))
+	s.mux.Handle("GET "+db+"/time_travel/bookmark", s.auth(s.bookmark))
+	s.mux.Handle("POST "+db+"/time_travel/restore", s.auth(s.restore))
+	s.mux.Handle("POST "+db+"/export", s.auth(s.export))
+	s.mux.Handle("POST "+db+"/import", s.auth(s.importSQL))
+	// signed urls, which are authorized by being hard to guess rather than by token
+	s.mux.HandleFunc("GET /exports/{db}/{bookmark}/{options}", s.download)
+	s.mux.HandleFunc("PUT /uploads/{filename}", s.upload)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, 7000, "No route for that URI")
+	})
+}
+
+// ServeHTTP handle a request to the D1 REST API. Paths may include the /client/v4 prefix of the real API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		r = r.Clone(r.Context())
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, apiPrefix)
+	}
+	if s.logger == nil {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.mux.ServeHTTP(rec, r)
+	s.logger.Info("request",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", rec.status,
+		"duration", time.Since(start),
+	)
+}
+
+// auth reject requests without an accepted bearer token or for an unknown account
+func (s *Server) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || (len(s.tokens) > 0 && !s.tokens[token]) {
+			writeError(w, http.StatusUnauthorized, 10000, "Authentication error")
+			return
+		}
+		if account := r.PathValue("account"); len(s.accounts) > 0 && !s.accounts[account] {
+			writeError(w, http.StatusForbidden, 7003, "Could not route to "+r.URL.Path+", perhaps your object identifier is invalid?")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// statusRecorder remembers the status written to a response for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// envelope cloudflare's wrapper around every API response
+type envelope struct {
+	Result     any               `json:"result"`
+	ResultInfo *utils.ResultInfo `json:"result_info,omitempty"`
+	Success    bool              `json:"success"`
+	Errors     []utils.D1Err     `json:"errors"`
+	Messages   []string          `json:"messages"`
+}
+
+// writeResponse write the response of a mock call. Errors are reported with the status and
+// codes of an *utils.APIError, failed responses with status 400.
+func writeResponse[T any](w http.ResponseWriter, res *utils.APIResponse[T], err error) {
+	var apiErr *utils.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		status := apiErr.StatusCode
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, status, envelope{Errors: apiErr.Errors, Messages: apiErr.Messages})
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, 7500, err.Error())
+	case !res.Success:
+		writeJSON(w, http.StatusBadRequest, envelope{Errors: res.Errors, Messages: res.Messages})
+	default:
+		writeJSON(w, http.StatusOK, envelope{
+			Result:     res.Result,
+			ResultInfo: res.ResultInfo,
+			Success:    true,
+			Messages:   res.Messages,
+		})
+	}
+}
+
+// writeError write a failed envelope with a single error
+func writeError(w http.ResponseWriter, status int, code int, message string) {
+	writeJSON(w, status, envelope{Errors: []utils.D1Err{{Code: code, Message: message}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body envelope) {
+	if body.Errors == nil {
+		body.Errors = []utils.D1Err{}
+	}
+	if body.Messages == nil {
+		body.Messages = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
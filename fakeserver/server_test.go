@@ -0,0 +1,286 @@
+package fakeserver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/client"
+	"github.com/crosleyzack/cloudflare-d1-go/fakeserver"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newServer start a fake server accepting token for account, returning its url
+func newServer(t *testing.T) string {
+	m, err := mock.NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { m.Close() })
+	server := httptest.NewServer(fakeserver.New(m, fakeserver.WithTokens("token"), fakeserver.WithAccountIDs("account")))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func newClient(t *testing.T, opts ...client.Option) *client.Client {
+	c, err := client.NewClient("account", "token", append([]client.Option{client.WithBaseURL(newServer(t))}, opts...)...)
+	assert.NoError(t, err)
+	return c
+}
+
+func TestDatabaseLifecycle(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+
+	created, err := c.CreateDBWithOptions(ctx, "orders", cloudflared1.CreateDBOptions{
+		PrimaryLocationHint: cloudflared1.LocationWesternEurope,
+	})
+	assert.NoError(t, err)
+	assert.True(t, created.Success)
+	assert.Equal(t, "orders", created.Result.Name)
+	assert.Equal(t, cloudflared1.LocationWesternEurope, created.Result.PrimaryLocationHint)
+	dbID := created.Result.UUID.String()
+
+	// names are unique
+	dup, err := c.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	assert.False(t, dup.Success)
+
+	_, err = c.CreateDB(ctx, "users")
+	assert.NoError(t, err)
+	list, err := c.ListDB(ctx, cloudflared1.ListPerPage(1))
+	assert.NoError(t, err)
+	assert.Len(t, list.Result, 1)
+	assert.Equal(t, &utils.ResultInfo{Page: 1, PerPage: 1, Count: 1, TotalCount: 2}, list.ResultInfo)
+	id, err := c.ResolveID(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, dbID, id)
+
+	updated, err := c.UpdateDB(ctx, dbID, cloudflared1.DBSettings{Replication: cloudflared1.ReadReplicationModeAuto})
+	assert.NoError(t, err)
+	assert.Equal(t, cloudflared1.ReadReplicationModeAuto, updated.Result.ReadReplication.Mode)
+	got, err := c.GetDB(ctx, dbID)
+	assert.NoError(t, err)
+	assert.Equal(t, cloudflared1.ReadReplicationModeAuto, got.Result.ReadReplication.Mode)
+
+	deleted, err := c.DeleteDB(ctx, dbID)
+	assert.NoError(t, err)
+	assert.True(t, deleted.Success)
+	missing, err := c.GetDB(ctx, dbID)
+	assert.NoError(t, err)
+	assert.False(t, missing.Success)
+	assert.Equal(t, 7404, missing.Errors[0].Code)
+}
+
+func TestQueries(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+	created, err := c.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := created.Result.UUID.String()
+
+	batch, err := c.BatchQuery(ctx, dbID, []cloudflared1.Statement{
+		{SQL: "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, qty INTEGER)"},
+		{SQL: "INSERT INTO items (name, qty) VALUES (?, ?)", Params: []any{"apple", 3}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, batch.Success)
+	assert.Equal(t, int64(1), batch.Result[1].Meta.LastRowID)
+
+	res, err := c.QueryDB(ctx, dbID, "SELECT name, qty FROM items WHERE qty = ?", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{map[string]any{"name": "apple", "qty": float64(3)}}, res.Result[0].Results)
+
+	raw, err := c.QueryDBRaw(ctx, dbID, "SELECT id, name FROM items")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, raw.Result[0].Columns)
+	assert.Equal(t, [][]any{{float64(1), "apple"}}, raw.Result[0].Rows)
+
+	type item struct {
+		Name string
+		Qty  int
+	}
+	items, _, err := cloudflared1.Query[item](ctx, c, dbID, "SELECT name, qty FROM items")
+	assert.NoError(t, err)
+	assert.Equal(t, []item{{"apple", 3}}, items)
+
+	// SQL errors are failed responses, or errors with WithErrorOnFailure
+	failed, err := c.QueryDB(ctx, dbID, "SELECT * FROM missing")
+	assert.NoError(t, err)
+	assert.False(t, failed.Success)
+	assert.Contains(t, failed.Errors[0].Message, "no such table")
+
+	// the raw endpoint runs batches too, returning a result per statement
+	rawBatch, err := c.BatchQueryRaw(ctx, dbID, []cloudflared1.Statement{
+		{SQL: "INSERT INTO items (name, qty) VALUES (?, ?)", Params: []any{"pear", 1}},
+		{SQL: "SELECT name, qty FROM items ORDER BY id"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, rawBatch.Success)
+	assert.Len(t, rawBatch.Result, 2)
+	assert.Equal(t, 1, rawBatch.Result[0].Meta.Changes)
+	assert.Equal(t, []string{"name", "qty"}, rawBatch.Result[1].Columns)
+	assert.Equal(t, [][]any{{"apple", float64(3)}, {"pear", float64(1)}}, rawBatch.Result[1].Rows)
+}
+
+func TestBlobs(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+	created, err := c.CreateDB(ctx, "files")
+	assert.NoError(t, err)
+	dbID := created.Result.UUID.String()
+	_, err = c.QueryDB(ctx, dbID, "CREATE TABLE files (data BLOB)")
+	assert.NoError(t, err)
+
+	// blobs are sent and returned as arrays of numbers, as D1 encodes them
+	res, err := c.QueryDB(ctx, dbID, "INSERT INTO files (data) VALUES (?)", []byte{0, 'h', 'i', 255})
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	raw, err := c.QueryDBRaw(ctx, dbID, "SELECT typeof(data), data FROM files")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]any{{"blob", []any{float64(0), float64(104), float64(105), float64(255)}}}, raw.Result[0].Rows)
+	data, _, err := cloudflared1.QueryOne[[]byte](ctx, c, dbID, "SELECT data FROM files")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 'h', 'i', 255}, data)
+}
+
+func TestAuth(t *testing.T) {
+	url := newServer(t)
+	ctx := context.Background()
+
+	badToken, err := client.NewClient("account", "wrong", client.WithBaseURL(url), client.WithErrorOnFailure())
+	assert.NoError(t, err)
+	_, err = badToken.ListDB(ctx)
+	assert.True(t, errors.Is(err, utils.ErrUnauthorized))
+
+	badAccount, err := client.NewClient("other", "token", client.WithBaseURL(url), client.WithErrorOnFailure())
+	assert.NoError(t, err)
+	_, err = badAccount.ListDB(ctx)
+	var apiErr *utils.APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+
+	// the /client/v4 prefix of the real API is accepted
+	req, _ := http.NewRequest("GET", url+"/client/v4/accounts/account/d1/database", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTimeTravelExportImport(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+	created, err := c.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := created.Result.UUID.String()
+	_, err = c.QueryDB(ctx, dbID, "CREATE TABLE items (name TEXT); INSERT INTO items VALUES ('apple')")
+	assert.NoError(t, err)
+
+	before, err := c.GetBookmark(ctx, dbID)
+	assert.NoError(t, err)
+	_, err = c.QueryDB(ctx, dbID, "DELETE FROM items")
+	assert.NoError(t, err)
+	restored, err := c.RestoreBookmark(ctx, dbID, before.Result.Bookmark)
+	assert.NoError(t, err)
+	assert.True(t, restored.Success)
+	count, _, err := cloudflared1.QueryOne[int](ctx, c, dbID, "SELECT count(*) FROM items")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	at, err := c.GetBookmarkAt(ctx, dbID, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, at.Success)
+
+	var dump bytes.Buffer
+	exported, err := c.Export(ctx, dbID, &dump, cloudflared1.ExportOptions{PollInterval: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, cloudflared1.OperationComplete, exported.Result.Status)
+	assert.Contains(t, dump.String(), `INSERT INTO "items" ("name") VALUES('apple');`)
+	// the dump is dropped once downloaded
+	download, err := http.Get(exported.Result.Result.SignedURL)
+	assert.NoError(t, err)
+	download.Body.Close()
+	assert.Equal(t, http.StatusNotFound, download.StatusCode)
+
+	copied, err := c.CreateDB(ctx, "copy")
+	assert.NoError(t, err)
+	copyID := copied.Result.UUID.String()
+	imported, err := c.ImportSQL(ctx, copyID, &dump, cloudflared1.ImportOptions{PollInterval: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, cloudflared1.OperationComplete, imported.Result.Status)
+	name, _, err := cloudflared1.QueryOne[string](ctx, c, copyID, "SELECT name FROM items")
+	assert.NoError(t, err)
+	assert.Equal(t, "apple", name)
+
+	_, err = c.ImportSQL(ctx, copyID, strings.NewReader("INSERT INTO missing VALUES (1);"), cloudflared1.ImportOptions{PollInterval: time.Millisecond})
+	assert.ErrorContains(t, err, "no such table")
+}
+
+func TestExportsScoped(t *testing.T) {
+	url := newServer(t)
+	c, err := client.NewClient("account", "token", client.WithBaseURL(url))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"a", "b"} {
+		created, err := c.CreateDB(ctx, name)
+		assert.NoError(t, err)
+		ids = append(ids, created.Result.UUID.String())
+	}
+	_, err = c.QueryDB(ctx, ids[0], "CREATE TABLE items (name TEXT); INSERT INTO items VALUES ('apple')")
+	assert.NoError(t, err)
+
+	// export posts to the export endpoint of dbID, returning the operation reported
+	export := func(dbID string, body string) (int, cloudflared1.ExportOperation) {
+		req, _ := http.NewRequest("POST", url+"/accounts/account/d1/database/"+dbID+"/export", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		var res utils.APIResponse[cloudflared1.ExportOperation]
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return resp.StatusCode, res.Result
+	}
+	download := func(signedURL string) (int, string) {
+		resp, err := http.Get(signedURL)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	// exports with other dump options at the same bookmark are kept apart
+	_, schema := export(ids[0], `{"dump_options": {"no_data": true}}`)
+	_, rows := export(ids[0], `{"dump_options": {"no_schema": true}}`)
+	assert.Equal(t, schema.AtBookmark, rows.AtBookmark)
+
+	// another database cannot poll an export
+	status, _ := export(ids[1], `{"dump_options": {"no_data": true}, "current_bookmark": "`+schema.AtBookmark+`"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, polled := export(ids[0], `{"dump_options": {"no_data": true}, "current_bookmark": "`+schema.AtBookmark+`"}`)
+	assert.Equal(t, http.StatusOK, status)
+	// nor download it
+	status, _ = download(strings.Replace(polled.Result.SignedURL, ids[0], ids[1], 1))
+	assert.Equal(t, http.StatusNotFound, status)
+	status, dump := download(polled.Result.SignedURL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, dump, "CREATE TABLE items")
+	assert.NotContains(t, dump, "INSERT INTO")
+
+	_, polled = export(ids[0], `{"dump_options": {"no_schema": true}, "current_bookmark": "`+rows.AtBookmark+`"}`)
+	status, dump = download(polled.Result.SignedURL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, dump, "INSERT INTO")
+	assert.NotContains(t, dump, "CREATE TABLE")
+}
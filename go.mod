@@ -7,6 +7,7 @@ toolchain go1.23.11
 require (
 	github.com/google/uuid v1.6.0
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/term v0.33.0
 	modernc.org/sqlite v1.38.1
 )
 
@@ -0,0 +1,48 @@
+package cloudflared1
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+// Importer is implemented by clients which can load a SQL file into a database.
+// https://developers.cloudflare.com/d1/best-practices/import-export-data/
+type Importer interface {
+	// ImportSQL execute the SQL statements read from r against the database, returning the completed import operation
+	ImportSQL(ctx context.Context, dbID string, r io.Reader, opts ImportOptions) (*utils.APIResponse[ImportOperation], error)
+}
+
+// ImportOptions controls how an import is reported
+type ImportOptions struct {
+	// PollInterval how often to check whether the import is finished, DefaultPollInterval if zero
+	PollInterval time.Duration
+	// Progress called as the SQL file is uploaded, if not nil
+	Progress utils.ProgressFunc
+}
+
+// ImportOperation state of an asynchronous import
+type ImportOperation struct {
+	// AtBookmark point in the database history the import is running at, used to poll the import
+	AtBookmark string   `json:"at_bookmark,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Filename   string   `json:"filename,omitempty"`
+	Messages   []string `json:"messages,omitempty"`
+	// Result summary of the import once Status is complete
+	Result  *ImportResult `json:"result,omitempty"`
+	Status  string        `json:"status,omitempty"`
+	Success bool          `json:"success"`
+	Type    string        `json:"type,omitempty"`
+	// UploadURL signed url the SQL file is uploaded to
+	UploadURL string `json:"upload_url,omitempty"`
+}
+
+// ImportResult summary of a completed import
+type ImportResult struct {
+	// FinalBookmark state of the database after the import, restore AtBookmark to undo it
+	FinalBookmark string `json:"final_bookmark"`
+	Meta          Meta   `json:"meta"`
+	NumQueries    int    `json:"num_queries"`
+}
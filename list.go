@@ -0,0 +1,90 @@
+package cloudflared1
+
+import (
+	"context"
+	"iter"
+)
+
+// DefaultPerPage number of databases returned per page when not specified
+const DefaultPerPage = 1000
+
+// ListDBOptions filtering and pagination for ListDB
+type ListDBOptions struct {
+	// Name only list databases whose name matches
+	Name string
+	// Page to return, starting from 1
+	Page int
+	// PerPage number of databases per page
+	PerPage int
+}
+
+// ListDBOption sets a field of ListDBOptions
+type ListDBOption func(*ListDBOptions)
+
+// ListByName only list databases whose name matches name
+func ListByName(name string) ListDBOption {
+	return func(o *ListDBOptions) {
+		o.Name = name
+	}
+}
+
+// ListPage return the given page of results, starting from 1
+func ListPage(page int) ListDBOption {
+	return func(o *ListDBOptions) {
+		o.Page = page
+	}
+}
+
+// ListPerPage return up to perPage databases per page
+func ListPerPage(perPage int) ListDBOption {
+	return func(o *ListDBOptions) {
+		o.PerPage = perPage
+	}
+}
+
+// NewListDBOptions apply opts over the defaults of page 1 and DefaultPerPage
+func NewListDBOptions(opts ...ListDBOption) ListDBOptions {
+	o := ListDBOptions{
+		Page:    1,
+		PerPage: DefaultPerPage,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Page < 1 {
+		o.Page = 1
+	}
+	if o.PerPage < 1 {
+		o.PerPage = DefaultPerPage
+	}
+	return o
+}
+
+// AllDatabases iterate over every database in the account, requesting pages from ListDB as needed.
+// Iteration stops after the first error, which is yielded with an empty database.
+func AllDatabases(ctx context.Context, d1 CloudflareD1, opts ...ListDBOption) iter.Seq2[D1Database, error] {
+	return func(yield func(D1Database, error) bool) {
+		o := NewListDBOptions(opts...)
+		for page := o.Page; ; page++ {
+			res, err := d1.ListDB(ctx, ListByName(o.Name), ListPage(page), ListPerPage(o.PerPage))
+			if err == nil {
+				err = res.Err()
+			}
+			if err != nil {
+				yield(D1Database{}, err)
+				return
+			}
+			for _, db := range res.Result {
+				if !yield(db, nil) {
+					return
+				}
+			}
+			if len(res.Result) == 0 || len(res.Result) < o.PerPage {
+				return
+			}
+			if info := res.ResultInfo; info != nil && info.TotalCount > 0 && page*o.PerPage >= info.TotalCount {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package cloudflared1_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllDatabases(t *testing.T) {
+	client, err := mock.NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	for i := range 7 {
+		_, err := client.CreateDB(ctx, fmt.Sprintf("db-%d", i))
+		assert.NoError(t, err)
+	}
+	_, err = client.CreateDB(ctx, "other")
+	assert.NoError(t, err)
+
+	// every page is walked transparently
+	var names []string
+	for db, err := range cloudflared1.AllDatabases(ctx, client, cloudflared1.ListPerPage(3)) {
+		assert.NoError(t, err)
+		names = append(names, db.Name)
+	}
+	assert.Equal(t, []string{"db-0", "db-1", "db-2", "db-3", "db-4", "db-5", "db-6", "other"}, names)
+
+	// filters are applied to every page
+	names = nil
+	for db, err := range cloudflared1.AllDatabases(ctx, client, cloudflared1.ListByName("db-"), cloudflared1.ListPerPage(2)) {
+		assert.NoError(t, err)
+		names = append(names, db.Name)
+	}
+	assert.Len(t, names, 7)
+
+	// stopping early is respected
+	count := 0
+	for range cloudflared1.AllDatabases(ctx, client, cloudflared1.ListPerPage(2)) {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	assert.Equal(t, 3, count)
+}
@@ -0,0 +1,254 @@
+// Package migrate applies numbered SQL migration files to a D1 database. Applied migrations are
+// recorded in the d1_migrations table wrangler uses, so the two tools can migrate the same database.
+//
+// Migrations are read from any fs.FS, such as a directory or an embed.FS:
+//
+//	//go:embed migrations/*.sql
+//	var files embed.FS
+//
+//	sub, _ := fs.Sub(files, "migrations")
+//	applied, err := migrate.New(client, dbID, sub).Apply(ctx)
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+const (
+	// DefaultTable table applied migrations are recorded in, the default of wrangler
+	DefaultTable = "d1_migrations"
+	// DefaultDir directory migrations are kept in, the default of wrangler
+	DefaultDir = "migrations"
+)
+
+// ErrInvalidName returned for a .sql file in the migrations directory whose name does not start with a number
+var ErrInvalidName = errors.New("migrate: migration file names must start with a number, such as 0001_create_users.sql")
+
+// Migration a single migration file
+type Migration struct {
+	// Name file name of the migration, which is recorded in the migrations table once applied
+	Name string
+	// Number leading number of the file name, which orders migrations
+	Number int
+	// SQL statements of the migration
+	SQL string
+	// Applied the migration is recorded in the migrations table
+	Applied bool
+	// AppliedAt time the migration was applied, if it has been
+	AppliedAt time.Time
+}
+
+// Migrator applies the migrations in a file system to a database
+type Migrator struct {
+	d1    cloudflared1.CloudflareD1
+	dbID  string
+	fsys  fs.FS
+	table string
+}
+
+// Option configures optional settings on a Migrator
+type Option func(*Migrator)
+
+// WithTable record applied migrations in table rather than DefaultTable,
+// matching the migrations_table setting of wrangler
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// New create a Migrator applying the .sql files at the root of fsys to database dbID
+func New(d1 cloudflared1.CloudflareD1, dbID string, fsys fs.FS, opts ...Option) *Migrator {
+	m := &Migrator{
+		d1:    d1,
+		dbID:  dbID,
+		fsys:  fsys,
+		table: DefaultTable,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// List the migrations in the file system, in the order they are applied: by number, then by name
+func (m *Migrator) List() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+		number, err := parseNumber(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.ReadFile(m.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Name: name, Number: number, SQL: string(data)})
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		if a.Number != b.Number {
+			return a.Number - b.Number
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return migrations, nil
+}
+
+// parseNumber leading number of a migration file name
+func parseNumber(name string) (int, error) {
+	digits := len(name) - len(strings.TrimLeft(name, "0123456789"))
+	if digits == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	return strconv.Atoi(name[:digits])
+}
+
+// Status list every migration in the file system, marking those recorded as applied.
+// It does not create the migrations table.
+func (m *Migrator) Status(ctx context.Context) ([]Migration, error) {
+	migrations, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	exists, _, err := cloudflared1.QueryOne[bool](ctx, m.d1, m.dbID,
+		"SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?", m.table)
+	if err != nil || !exists {
+		return migrations, err
+	}
+	return m.markApplied(ctx, migrations)
+}
+
+// markApplied mark the migrations recorded in the migrations table as applied
+func (m *Migrator) markApplied(ctx context.Context, migrations []Migration) ([]Migration, error) {
+	type record struct {
+		Name      string    `d1:"name"`
+		AppliedAt time.Time `d1:"applied_at"`
+	}
+	records, _, err := cloudflared1.Query[record](ctx, m.d1, m.dbID,
+		fmt.Sprintf("SELECT name, applied_at FROM %s ORDER BY id", quoteIdent(m.table)))
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]time.Time, len(records))
+	for _, r := range records {
+		applied[r.Name] = r.AppliedAt
+	}
+	for i := range migrations {
+		migrations[i].AppliedAt, migrations[i].Applied = applied[migrations[i].Name]
+	}
+	return migrations, nil
+}
+
+// Apply apply each pending migration in order, returning those applied. Each migration runs as a
+// single atomic batch together with its record in the migrations table, so a failed migration
+// leaves no trace and can be fixed and applied again. Applying stops at the first failure, returning
+// the migrations applied before it along with the error.
+func (m *Migrator) Apply(ctx context.Context) ([]Migration, error) {
+	migrations, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	// the schema wrangler creates, so either tool can apply the next migration
+	res, err := m.d1.QueryDB(ctx, m.dbID, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT UNIQUE,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+)`, quoteIdent(m.table)))
+	if err == nil {
+		err = res.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("migrate: creating %s: %w", m.table, err)
+	}
+	migrations, err = m.markApplied(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, migration := range migrations {
+		if migration.Applied {
+			continue
+		}
+		if err := m.apply(ctx, migration); err != nil {
+			return applied, fmt.Errorf("migrate: applying %s: %w", migration.Name, err)
+		}
+		migration.Applied = true
+		migration.AppliedAt = time.Now().UTC()
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// apply run the statements of migration and record it in one batch
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	var statements []cloudflared1.Statement
+	for _, sql := range utils.SplitStatements(migration.SQL) {
+		statements = append(statements, cloudflared1.Statement{SQL: sql, Params: []any{}})
+	}
+	statements = append(statements, cloudflared1.Statement{
+		SQL:    fmt.Sprintf("INSERT INTO %s (name) VALUES (?)", quoteIdent(m.table)),
+		Params: []any{migration.Name},
+	})
+	res, err := m.d1.BatchQuery(ctx, m.dbID, statements)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// Create write an empty migration to dir, numbered after the last migration in it, and return its path.
+// The file is named and headed the way wrangler's migrations create does, such as 0002_add_users.sql
+// for the description "add users".
+func Create(dir string, description string) (string, error) {
+	description = strings.ReplaceAll(strings.TrimSpace(description), " ", "_")
+	if description == "" || strings.ContainsAny(description, `/\`) {
+		return "", fmt.Errorf("migrate: invalid migration description %q", description)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	migrations, err := New(nil, "", os.DirFS(dir)).List()
+	if err != nil {
+		return "", err
+	}
+	number := 1
+	if len(migrations) > 0 {
+		number = migrations[len(migrations)-1].Number + 1
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%04d_%s.sql", number, description))
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	_, err = fmt.Fprintf(f, "-- Migration number: %04d \t %s\n", number, time.Now().UTC().Format("2006-01-02T15:04:05.000Z"))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return file, err
+}
+
+// quoteIdent quote an identifier for use in SQL
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,142 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newDB create a database in a mock in a temporary directory
+func newDB(t *testing.T) (*mock.MockClient, string) {
+	m, err := mock.NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { m.Close() })
+	res, err := m.CreateDB(context.Background(), "app")
+	assert.NoError(t, err)
+	return m, res.Result.UUID.String()
+}
+
+var files = fstest.MapFS{
+	"0002_add_orders.sql": {Data: []byte(`-- Migration number: 0002
+CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER, total REAL);
+CREATE TRIGGER orders_audit AFTER INSERT ON orders BEGIN
+  UPDATE users SET orders = orders + 1 WHERE id = new.user_id;
+END;
+`)},
+	"0001_create_users.sql": {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, orders INTEGER DEFAULT 0);")},
+	"0010_seed.sql":         {Data: []byte("INSERT INTO users (name) VALUES ('alice');\nINSERT INTO orders (user_id, total) VALUES (1, 9.5);")},
+	"README.md":             {Data: []byte("not a migration")},
+}
+
+func TestList(t *testing.T) {
+	migrations, err := New(nil, "", files).List()
+	assert.NoError(t, err)
+	var names []string
+	for _, m := range migrations {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"0001_create_users.sql", "0002_add_orders.sql", "0010_seed.sql"}, names)
+	assert.Equal(t, 10, migrations[2].Number)
+
+	_, err = New(nil, "", fstest.MapFS{"init.sql": {}}).List()
+	assert.True(t, errors.Is(err, ErrInvalidName))
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	m, dbID := newDB(t)
+	migrator := New(m, dbID, files)
+
+	// nothing is applied, and the table is not created, until Apply
+	status, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, status, 3)
+	assert.False(t, status[0].Applied)
+
+	applied, err := migrator.Apply(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 3)
+	assert.Equal(t, "0001_create_users.sql", applied[0].Name)
+	orders, _, err := cloudflared1.QueryOne[int](ctx, m, dbID, "SELECT orders FROM users WHERE name = 'alice'")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, orders)
+
+	// recorded in the wrangler table, in order
+	names, _, err := cloudflared1.Query[string](ctx, m, dbID, "SELECT name FROM d1_migrations ORDER BY id")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0001_create_users.sql", "0002_add_orders.sql", "0010_seed.sql"}, names)
+	status, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	for _, s := range status {
+		assert.True(t, s.Applied, s.Name)
+		assert.False(t, s.AppliedAt.IsZero(), s.Name)
+	}
+
+	applied, err = migrator.Apply(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+func TestApplyWranglerTable(t *testing.T) {
+	ctx := context.Background()
+	m, dbID := newDB(t)
+	// a database wrangler has already applied the first migration to
+	_, err := m.QueryDB(ctx, dbID, `CREATE TABLE IF NOT EXISTS d1_migrations(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT UNIQUE,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, orders INTEGER DEFAULT 0);
+INSERT INTO d1_migrations (name) VALUES ('0001_create_users.sql');`)
+	assert.NoError(t, err)
+
+	applied, err := New(m, dbID, files).Apply(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.Equal(t, "0002_add_orders.sql", applied[0].Name)
+}
+
+func TestApplyFailure(t *testing.T) {
+	ctx := context.Background()
+	m, dbID := newDB(t)
+	broken := fstest.MapFS{
+		"0001_create_users.sql": files["0001_create_users.sql"],
+		"0002_broken.sql":       {Data: []byte("CREATE TABLE partial (id INTEGER);\nINSERT INTO missing VALUES (1);")},
+	}
+	applied, err := New(m, dbID, broken, WithTable("schema_migrations")).Apply(ctx)
+	assert.ErrorContains(t, err, "applying 0002_broken.sql")
+	assert.ErrorContains(t, err, "no such table: missing")
+	assert.Len(t, applied, 1)
+
+	// the failed migration left nothing behind
+	names, _, err := cloudflared1.Query[string](ctx, m, dbID, "SELECT name FROM schema_migrations")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0001_create_users.sql"}, names)
+	_, _, err = cloudflared1.Query[int](ctx, m, dbID, "SELECT id FROM partial")
+	assert.ErrorContains(t, err, "no such table: partial")
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	path, err := Create(dir, "create users")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "0001_create_users.sql"), path)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^-- Migration number: 0001 \t \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z\n$`, string(data))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "0007_manual.sql"), nil, 0o644))
+	path, err = Create(dir, "add orders")
+	assert.NoError(t, err)
+	assert.Equal(t, "0008_add_orders.sql", filepath.Base(path))
+
+	_, err = Create(dir, "../escape")
+	assert.Error(t, err)
+}
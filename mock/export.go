@@ -0,0 +1,212 @@
+package mock
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+var _ cloudflared1.Exporter = (*MockClient)(nil)
+
+// Export write a SQL dump of the local sqlite db to w, in the same layout as a D1 export:
+// tables and their rows, then indexes, triggers and views.
+func (m *MockClient) Export(ctx context.Context, dbID string, w io.Writer, opts cloudflared1.ExportOptions) (*utils.APIResponse[cloudflared1.ExportOperation], error) {
+	db, h, ok := m.lock(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	bookmark := h.latest(dbID)
+	var buf bytes.Buffer
+	err := dumpSQL(ctx, db, &buf, opts)
+	h.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, utils.NewProgressReader(&buf, int64(buf.Len()), opts.Progress)); err != nil {
+		return nil, err
+	}
+	return &utils.APIResponse[cloudflared1.ExportOperation]{
+		Result: cloudflared1.ExportOperation{
+			AtBookmark: bookmark,
+			Result: &cloudflared1.ExportFile{
+				Filename: fmt.Sprintf("%s-%s.sql", dbID, bookmark),
+			},
+			Status:  cloudflared1.OperationComplete,
+			Success: true,
+			Type:    "export",
+		},
+		Success: true,
+		Errors:  nil,
+	}, nil
+}
+
+// schemaObject an entry of sqlite_master
+type schemaObject struct {
+	kind, name, table, sql string
+}
+
+// dumpSQL write the schema and rows of db as SQL statements, reading from a single transaction
+// so the dump is consistent.
+func dumpSQL(ctx context.Context, db *sql.DB, w io.Writer, opts cloudflared1.ExportOptions) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	objects, err := schemaObjects(ctx, tx, opts.Tables)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "PRAGMA defer_foreign_keys=TRUE;")
+	var tables []string
+	for _, obj := range objects {
+		if obj.kind != "table" {
+			continue
+		}
+		tables = append(tables, obj.name)
+		if !opts.NoSchema {
+			fmt.Fprintf(bw, "%s;\n", obj.sql)
+		}
+		if !opts.NoData {
+			if err := dumpRows(ctx, tx, bw, obj.name); err != nil {
+				return err
+			}
+		}
+	}
+	if !opts.NoData {
+		if err := dumpSequences(ctx, tx, bw, tables); err != nil {
+			return err
+		}
+	}
+	if !opts.NoSchema {
+		for _, obj := range objects {
+			if obj.kind != "table" {
+				fmt.Fprintf(bw, "%s;\n", obj.sql)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// schemaObjects user defined tables, indexes, triggers and views in creation order,
+// limited to those on the given tables when any are given
+func schemaObjects(ctx context.Context, tx *sql.Tx, tables []string) ([]schemaObject, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT type, name, tbl_name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' AND name NOT LIKE '_cf_%' ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var objects []schemaObject
+	for rows.Next() {
+		var obj schemaObject
+		if err := rows.Scan(&obj.kind, &obj.name, &obj.table, &obj.sql); err != nil {
+			return nil, err
+		}
+		if len(tables) > 0 && !slices.Contains(tables, obj.table) {
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	return objects, rows.Err()
+}
+
+// dumpRows write an INSERT statement for each row of table. Values are rendered by
+// sqlite's quote() so they round trip exactly, including blobs and reals.
+func dumpRows(ctx context.Context, tx *sql.Tx, w io.Writer, table string) error {
+	columns, err := tableColumns(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(columns))
+	selects := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdent(col)
+		selects[i] = fmt.Sprintf("quote(%s)", quoteIdent(col))
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "), quoteIdent(table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	values := make([]string, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES(", quoteIdent(table), strings.Join(quoted, ","))
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s%s);\n", prefix, strings.Join(values, ","))
+	}
+	return rows.Err()
+}
+
+// tableColumns names of the insertable columns of table
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// dumpSequences write the AUTOINCREMENT counters of tables, if the database has any
+func dumpSequences(ctx context.Context, tx *sql.Tx, w io.Writer, tables []string) error {
+	var exists int
+	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE name = 'sqlite_sequence'").Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return nil
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT name, seq FROM sqlite_sequence")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var seq int64
+		if err := rows.Scan(&name, &seq); err != nil {
+			return err
+		}
+		if !slices.Contains(tables, name) {
+			continue
+		}
+		fmt.Fprintf(w, "DELETE FROM sqlite_sequence WHERE name = %s;\n", quoteLiteral(name))
+		fmt.Fprintf(w, "INSERT INTO sqlite_sequence (name, seq) VALUES(%s, %d);\n", quoteLiteral(name), seq)
+	}
+	return rows.Err()
+}
+
+// quoteIdent quote a table or column name
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral quote a string value
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
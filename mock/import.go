@@ -0,0 +1,93 @@
+package mock
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+var _ cloudflared1.Importer = (*MockClient)(nil)
+
+// ImportSQL execute the SQL file read from r against the local sqlite db in a single transaction,
+// so a failed import leaves the database unchanged. A failed import is reported as a failed
+// response holding the operation, with its status set to error.
+func (m *MockClient) ImportSQL(ctx context.Context, dbID string, r io.Reader, opts cloudflared1.ImportOptions) (*utils.APIResponse[cloudflared1.ImportOperation], error) {
+	data, err := io.ReadAll(utils.NewProgressReader(r, -1, opts.Progress))
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum(data)
+	etag := hex.EncodeToString(sum[:])
+	db, h, ok := m.lock(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	defer h.mu.Unlock()
+	before := h.latest(dbID)
+
+	meta, err := execScript(ctx, db, string(data))
+	if err != nil {
+		apiErr := errToApiResp(err)
+		return &utils.APIResponse[cloudflared1.ImportOperation]{
+			Result: cloudflared1.ImportOperation{
+				AtBookmark: before,
+				Error:      apiErr.Message,
+				Filename:   etag + ".sql",
+				Status:     cloudflared1.OperationError,
+				Success:    false,
+				Type:       "import",
+			},
+			Success: false,
+			Errors:  []utils.D1Err{apiErr},
+		}, nil
+	}
+	m.recordWrite(ctx, dbID, db, h)
+	return &utils.APIResponse[cloudflared1.ImportOperation]{
+		Result: cloudflared1.ImportOperation{
+			AtBookmark: before,
+			Filename:   etag + ".sql",
+			Result: &cloudflared1.ImportResult{
+				FinalBookmark: h.latest(dbID),
+				Meta:          meta,
+				NumQueries:    len(utils.SplitStatements(string(data))),
+			},
+			Status:  cloudflared1.OperationComplete,
+			Success: true,
+			Type:    "import",
+		},
+		Success: true,
+		Errors:  nil,
+	}, nil
+}
+
+// execScript execute every statement in script within a transaction, returning the rows changed
+func execScript(ctx context.Context, db *sql.DB, script string) (cloudflared1.Meta, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return cloudflared1.Meta{}, err
+	}
+	defer tx.Rollback()
+	before, err := readCounters(ctx, tx)
+	if err != nil {
+		return cloudflared1.Meta{}, err
+	}
+	start := time.Now()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return cloudflared1.Meta{}, err
+	}
+	elapsed := time.Since(start)
+	after, err := readCounters(ctx, tx)
+	if err != nil {
+		return cloudflared1.Meta{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return cloudflared1.Meta{}, err
+	}
+	return statementMeta(before, after, 0, 0, elapsed), nil
+}
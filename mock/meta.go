@@ -0,0 +1,93 @@
+package mock
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+)
+
+// counters connection level state read before and after a statement to derive its meta
+type counters struct {
+	totalChanges  int64
+	changes       int64
+	lastRowID     int64
+	schemaVersion int64
+	size          int64
+}
+
+// readCounters read the change counters, schema version and size of the database from db
+func readCounters(ctx context.Context, db execQueryer) (counters, error) {
+	var c counters
+	err := db.QueryRowContext(ctx, `SELECT total_changes(), changes(), last_insert_rowid(),
+		(SELECT schema_version FROM pragma_schema_version()),
+		(SELECT page_count FROM pragma_page_count()) * (SELECT page_size FROM pragma_page_size())`,
+	).Scan(&c.totalChanges, &c.changes, &c.lastRowID, &c.schemaVersion, &c.size)
+	return c, err
+}
+
+// statementMeta meta for a statement which returned rowCount rows and ran for elapsed,
+// given the counters before and after it and an estimate of the rows it scanned.
+//
+// sqlite's per statement counters are not reachable through database/sql, so rows read is
+// the largest of the rows returned, changed and scanned. Rows written counts every row
+// changed, including by triggers.
+func statementMeta(before, after counters, rowCount, scanned int, elapsed time.Duration) cloudflared1.Meta {
+	written := after.totalChanges - before.totalChanges
+	// changes() still holds the count of the last write when this statement wrote nothing
+	changes := after.changes
+	if written == 0 {
+		changes = 0
+	}
+	ms := float64(elapsed.Microseconds()) / 1000
+	return cloudflared1.Meta{
+		ChangedDB:       written > 0 || after.schemaVersion != before.schemaVersion,
+		Changes:         int(changes),
+		Duration:        ms,
+		LastRowID:       after.lastRowID,
+		RowsRead:        max(rowCount, int(changes), scanned),
+		RowsWritten:     int(written),
+		ServedByPrimary: true,
+		ServedByRegion:  "mock-region",
+		SizeAfter:       after.size,
+		Timings: &cloudflared1.Timings{
+			SQLDurationMS: ms,
+		},
+	}
+}
+
+// estimateScanned estimate the rows query will scan, by summing the rows of every table its
+// query plan scans in full. Tables searched through an index add nothing, as the rows they
+// read are counted when stepped. A scan cut short by LIMIT is still counted in full, and
+// scans of tables named by an alias are not counted.
+func estimateScanned(ctx context.Context, db execQueryer, query string, params ...any) int {
+	rows, err := db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, params...)
+	if err != nil {
+		return 0
+	}
+	var tables []string
+	for rows.Next() {
+		var id, parent, unused any
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			break
+		}
+		// "SCAN items", or "SCAN TABLE items" in older versions of sqlite
+		fields := strings.Fields(strings.Replace(detail, "SCAN TABLE ", "SCAN ", 1))
+		if len(fields) >= 2 && fields[0] == "SCAN" {
+			tables = append(tables, fields[1])
+		}
+	}
+	rows.Close()
+
+	total := 0
+	for _, table := range tables {
+		var n int
+		// scans of constant rows, subqueries and aliases are not tables and fail to count
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdent(table)).Scan(&n); err == nil {
+			total += n
+		}
+	}
+	return total
+}
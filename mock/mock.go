@@ -5,9 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
@@ -21,15 +24,27 @@ const (
 	dbtype = "sqlite"
 )
 
+// MockClient implements CloudflareD1 against local sqlite databases.
+// It is safe for concurrent use.
 type MockClient struct {
-	dbpath    string
-	NameIDMap map[string]string
-	ConnMap   map[string]*sql.DB
+	dbpath string
+
+	// mu guards nameIDs, records, conns and histories. The lock of a history is taken before mu.
+	mu sync.RWMutex
+	// track map of dbName->dbID to facilitate lookups by name
+	nameIDs map[string]string
+	// metadata of each dbID, persisted to the registry file
+	records map[string]dbRecord
+	// open connection for each dbID
+	conns map[string]*sql.DB
+	// copies of each dbID, emulating time travel
+	histories map[string]*history
 }
 
 var _ cloudflared1.CloudflareD1 = (*MockClient)(nil)
 
-// NewMockClient creates a new client for interfacing with local sqlite
+// NewMockClient creates a new client for interfacing with local sqlite.
+// Databases recorded in the registry file of dbpath by an earlier client are reopened.
 func NewMockClient(dbpath string) (*MockClient, error) {
 	if len(dbpath) == 0 {
 		return nil, errors.New("DBPath cannot be empty")
@@ -38,45 +53,191 @@ func NewMockClient(dbpath string) (*MockClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &MockClient{
+	m := &MockClient{
 		dbpath:    p,
-		NameIDMap: map[string]string{},
-		ConnMap:   map[string]*sql.DB{},
-	}, nil
+		nameIDs:   map[string]string{},
+		records:   map[string]dbRecord{},
+		conns:     map[string]*sql.DB{},
+		histories: map[string]*history{},
+	}
+	if err := m.reopen(); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// reopen open every database in the registry whose file still exists. History from
+// earlier clients is discarded, so each database starts with a single bookmark.
+func (m *MockClient) reopen() error {
+	records, err := m.loadRegistry()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		path := m.getDBPath(rec.UUID)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		db, err := openDB(path)
+		if err != nil {
+			return err
+		}
+		m.conns[rec.UUID] = db
+		h, err := m.newHistory(context.Background(), rec.UUID, db)
+		if err != nil {
+			return err
+		}
+		m.nameIDs[rec.Name] = rec.UUID
+		m.records[rec.UUID] = rec
+		m.histories[rec.UUID] = h
+	}
+	if len(m.records) != len(records) {
+		// drop databases whose files were removed
+		return m.updateRegistry(func(records map[string]dbRecord) error {
+			for id := range records {
+				if _, err := os.Stat(m.getDBPath(id)); errors.Is(err, os.ErrNotExist) {
+					delete(records, id)
+				}
+			}
+			return nil
+		})
+	}
+	return nil
 }
 
 func (m *MockClient) Close() error {
-	for _, conn := range m.ConnMap {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, conn := range m.conns {
 		err := conn.Close()
 		if err != nil {
 			return err
 		}
+		delete(m.conns, id)
 	}
 	return nil
 }
 
+// LookupID return the ID of a database created by this client, by name.
+func (m *MockClient) LookupID(name string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, ok := m.nameIDs[name]
+	return id, ok
+}
+
+// ResolveID return the ID of a database given its name or ID
+func (m *MockClient) ResolveID(_ context.Context, nameOrID string) (string, error) {
+	if _, err := uuid.Parse(nameOrID); err == nil {
+		return nameOrID, nil
+	}
+	if id, ok := m.LookupID(nameOrID); ok {
+		return id, nil
+	}
+	return "", errNotFound(nameOrID)
+}
+
+// GetDBByName Retrieve database information for local sqlite db by name
+func (m *MockClient) GetDBByName(ctx context.Context, name string) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	id, err := m.ResolveID(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetDB(ctx, id)
+}
+
+// record return the metadata of a database by id
+func (m *MockClient) record(dbID string) dbRecord {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.records[dbID]
+}
+
+// openDB open a connection to a sqlite file. Connections are limited to one so
+// concurrent writers queue rather than failing with SQLITE_BUSY.
+func openDB(path string) (*sql.DB, error) {
+	db, err := sql.Open(dbtype, path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
 // CreateDB create a new database in the local sqlite database
 func (m *MockClient) CreateDB(ctx context.Context, name string) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	return m.CreateDBWithOptions(ctx, name, cloudflared1.CreateDBOptions{})
+}
+
+// CreateDBWithOptions create a new database in the local sqlite database.
+// The location hint and jurisdiction are only recorded and reported, as all databases are local.
+// Names must be unique, as they are in D1.
+func (m *MockClient) CreateDBWithOptions(ctx context.Context, name string, opts cloudflared1.CreateDBOptions) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	if _, ok := m.LookupID(name); ok {
+		return nil, errNameExists()
+	}
 	uid := uuid.New()
 	path := m.getDBPath(uid.String())
-	db, err := sql.Open(dbtype, path)
+	db, err := openDB(path)
 	if err != nil {
 		return nil, err
 	}
+	// the empty database is the first point in its history
+	h, err := m.newHistory(ctx, uid.String(), db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 	// Mock implementation - create a basic D1Database response
 	database := cloudflared1.D1Database{
-		CreatedAt: time.Now().Format(time.RFC3339),
-		FileSize:  0,
-		Name:      name,
-		NumTables: 0,
+		CreatedAt:           time.Now().Format(time.RFC3339),
+		FileSize:            0,
+		Jurisdiction:        opts.Jurisdiction,
+		Name:                name,
+		NumTables:           0,
+		PrimaryLocationHint: opts.PrimaryLocationHint,
 		ReadReplication: cloudflared1.ReadReplication{
 			Mode: cloudflared1.ReadReplicationModeDisabled,
 		},
 		UUID:    uid,
 		Version: "1.0.0",
 	}
-	m.NameIDMap[name] = uid.String()
-	m.ConnMap[uid.String()] = db
+	rec := dbRecord{
+		UUID:                uid.String(),
+		Name:                name,
+		CreatedAt:           database.CreatedAt,
+		ReadReplication:     database.ReadReplication,
+		PrimaryLocationHint: opts.PrimaryLocationHint,
+		Jurisdiction:        opts.Jurisdiction,
+	}
+	m.mu.Lock()
+	// check the name again against the registry, which other clients on the directory share
+	err = m.updateRegistry(func(records map[string]dbRecord) error {
+		if _, ok := m.nameIDs[name]; ok {
+			return errNameExists()
+		}
+		for _, other := range records {
+			if other.Name == name {
+				return errNameExists()
+			}
+		}
+		records[rec.UUID] = rec
+		return nil
+	})
+	if err == nil {
+		m.nameIDs[name] = rec.UUID
+		m.records[rec.UUID] = rec
+		m.conns[rec.UUID] = db
+		m.histories[rec.UUID] = h
+	}
+	m.mu.Unlock()
+	if err != nil {
+		db.Close()
+		os.Remove(path)
+		os.RemoveAll(m.historyDir(rec.UUID))
+		return nil, err
+	}
 
 	return &utils.APIResponse[cloudflared1.D1Database]{
 		Result:  database,
@@ -87,14 +248,38 @@ func (m *MockClient) CreateDB(ctx context.Context, name string) (*utils.APIRespo
 
 // DeleteDB delete a new database in the local sqlite database by id
 func (m *MockClient) DeleteDB(_ context.Context, dbID string) (*utils.APIResponse[cloudflared1.DeleteResult], error) {
-	conn, ok := m.ConnMap[dbID]
+	// wait for queries running against the database
+	if h, ok := m.historyOf(dbID); ok {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+	}
+	m.mu.Lock()
+	conn, ok := m.conns[dbID]
+	delete(m.conns, dbID)
+	delete(m.records, dbID)
+	delete(m.histories, dbID)
+	for name, id := range m.nameIDs {
+		if id == dbID {
+			delete(m.nameIDs, name)
+		}
+	}
+	err := m.updateRegistry(func(records map[string]dbRecord) error {
+		delete(records, dbID)
+		return nil
+	})
+	m.mu.Unlock()
 	if ok {
-		delete(m.ConnMap, dbID)
+		conn.Close()
+	}
+	if err != nil {
+		return nil, err
 	}
 	if err := os.Remove(m.getDBPath(dbID)); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
-	defer conn.Close()
+	if err := os.RemoveAll(m.historyDir(dbID)); err != nil {
+		return nil, err
+	}
 	return &utils.APIResponse[cloudflared1.DeleteResult]{
 		Result:  cloudflared1.DeleteResult{},
 		Success: true,
@@ -102,30 +287,37 @@ func (m *MockClient) DeleteDB(_ context.Context, dbID string) (*utils.APIRespons
 	}, nil
 }
 
-// UpdateDB fulfills interface however there is no relevant operation for a local sqlite
-func (m *MockClient) UpdateDB(_ context.Context, dbID string, settings cloudflared1.DBSettings) (*utils.APIResponse[cloudflared1.D1Database], error) {
-	return &utils.APIResponse[cloudflared1.D1Database]{
-		Result:  cloudflared1.D1Database{},
-		Success: false,
-		Errors: []utils.D1Err{
-			{
-				Code:    1,
-				Message: "There is no concept of replication modes in local sqlite",
-			},
-		},
-	}, nil
+// UpdateDB record the replication mode of the database. There are no replicas of a local sqlite
+// database, so the mode is only reported back by GetDB and ListDB.
+func (m *MockClient) UpdateDB(ctx context.Context, dbID string, settings cloudflared1.DBSettings) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	m.mu.Lock()
+	rec, ok := m.records[dbID]
+	if !ok {
+		m.mu.Unlock()
+		return nil, errNotFound(dbID)
+	}
+	rec.ReadReplication.Mode = settings.Replication
+	m.records[dbID] = rec
+	err := m.updateRegistry(func(records map[string]dbRecord) error {
+		records[dbID] = rec
+		return nil
+	})
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return m.GetDB(ctx, dbID)
 }
 
 // GetDB Retrieve database information for local sqlite db
-func (m *MockClient) GetDB(_ context.Context, dbID string) (*utils.APIResponse[cloudflared1.D1Database], error) {
-	db, ok := m.ConnMap[dbID]
+func (m *MockClient) GetDB(ctx context.Context, dbID string) (*utils.APIResponse[cloudflared1.D1Database], error) {
+	db, h, ok := m.lock(dbID)
 	if !ok {
-		return nil, fmt.Errorf("Invalid db id: %s", dbID)
+		return nil, errNotFound(dbID)
 	}
+	defer h.mu.Unlock()
 	var dbSize int64
-	var dbTime string
 	if fi, err := os.Stat(m.getDBPath(dbID)); err == nil {
-		dbTime = fi.ModTime().Format(time.RFC3339)
 		dbSize = fi.Size()
 	}
 	// get uuid from database id for return
@@ -133,16 +325,10 @@ func (m *MockClient) GetDB(_ context.Context, dbID string) (*utils.APIResponse[c
 	if err != nil {
 		return nil, err
 	}
-	// get name out of the map
-	dbname := ""
-	for name, id := range m.NameIDMap {
-		if id == dbID {
-			dbname = name
-			break
-		}
-	}
+	// get name, creation time and settings from the registry
+	rec := m.record(dbID)
 	// get tables in database
-	rows, err := db.Query("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name != 'android_metadata' AND name != 'sqlite_sequence';")
+	rows, err := db.QueryContext(ctx, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name != 'android_metadata' AND name != 'sqlite_sequence';")
 	if err != nil {
 		return nil, err
 	}
@@ -156,15 +342,15 @@ func (m *MockClient) GetDB(_ context.Context, dbID string) (*utils.APIResponse[c
 	}
 	// Mock implementation - return a mock database
 	database := cloudflared1.D1Database{
-		CreatedAt: dbTime,
-		FileSize:  dbSize,
-		Name:      dbname,
-		NumTables: count,
-		ReadReplication: cloudflared1.ReadReplication{
-			Mode: cloudflared1.ReadReplicationModeDisabled,
-		},
-		UUID:    uid,
-		Version: "1.0.0",
+		CreatedAt:           rec.CreatedAt,
+		FileSize:            dbSize,
+		Jurisdiction:        rec.Jurisdiction,
+		Name:                rec.Name,
+		NumTables:           count,
+		PrimaryLocationHint: rec.PrimaryLocationHint,
+		ReadReplication:     rec.ReadReplication,
+		UUID:                uid,
+		Version:             "1.0.0",
 	}
 
 	return &utils.APIResponse[cloudflared1.D1Database]{
@@ -174,59 +360,235 @@ func (m *MockClient) GetDB(_ context.Context, dbID string) (*utils.APIResponse[c
 	}, nil
 }
 
-func (m *MockClient) ListDB(ctx context.Context) (*utils.APIResponse[cloudflared1.D1DatabaseList], error) {
-	l := make(cloudflared1.D1DatabaseList, 0, len(m.NameIDMap))
-	for _, id := range m.NameIDMap {
-		res, err := m.GetDB(ctx, id)
+// ListDB list local sqlite databases ordered by name, filtered to names containing opts' name and paginated
+func (m *MockClient) ListDB(ctx context.Context, opts ...cloudflared1.ListDBOption) (*utils.APIResponse[cloudflared1.D1DatabaseList], error) {
+	o := cloudflared1.NewListDBOptions(opts...)
+	m.mu.RLock()
+	names := make([]string, 0, len(m.nameIDs))
+	for name := range m.nameIDs {
+		if strings.Contains(strings.ToLower(name), strings.ToLower(o.Name)) {
+			names = append(names, name)
+		}
+	}
+	m.mu.RUnlock()
+	slices.Sort(names)
+
+	// look every match up before paging, so databases which are skipped are not counted
+	all := make(cloudflared1.D1DatabaseList, 0, len(names))
+	for _, name := range names {
+		res, err := m.GetDBByName(ctx, name)
 		if err != nil {
 			// just skip this one
 			continue
 		}
-		l = append(l, res.Result)
+		all = append(all, res.Result)
 	}
+	start := min((o.Page-1)*o.PerPage, len(all))
+	end := min(start+o.PerPage, len(all))
+	l := all[start:end:end]
 
 	return &utils.APIResponse[cloudflared1.D1DatabaseList]{
-		Result:  l,
+		Result: l,
+		ResultInfo: &utils.ResultInfo{
+			Page:       o.Page,
+			PerPage:    o.PerPage,
+			Count:      len(l),
+			TotalCount: len(all),
+		},
 		Success: true,
 		Errors:  nil,
 	}, nil
 }
 
-// QueryDB execute a query on the local sqlite db
+// execQueryer a connection or transaction which statements can be run against
+type execQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// QueryDB execute a query on the local sqlite db.
+// A query holding several statements returns a result for each, as D1 does.
 func (m *MockClient) QueryDB(ctx context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
-	// local sqlite db separates operations that retrieve and alter data.
-	// check which we are doing and perform the appropriate operation
-	if strings.Contains(strings.ToLower(query), "select") {
-		return m.query(ctx, dbID, query, params...)
-	} else {
-		return m.exec(ctx, dbID, query, params...)
+	db, h, ok := m.lock(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	defer h.mu.Unlock()
+	raws, err := runQuery(ctx, db, query, params...)
+	// statements before a failing one may have committed
+	m.recordWrite(ctx, dbID, db, h)
+	if err != nil {
+		return failedQuery[cloudflared1.QueryResult[any]](err), nil
+	}
+	results := make([]cloudflared1.QueryResult[any], len(raws))
+	for i, raw := range raws {
+		results[i] = toQueryResult(raw)
+	}
+	return &utils.APIResponse[[]cloudflared1.QueryResult[any]]{
+		Result:  results,
+		Success: true,
+		Errors:  nil,
+	}, nil
+}
+
+// QueryDBRaw execute a query on the local sqlite db, returning rows as arrays
+func (m *MockClient) QueryDBRaw(ctx context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.RawResult], error) {
+	db, h, ok := m.lock(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	defer h.mu.Unlock()
+	raws, err := runQuery(ctx, db, query, params...)
+	// statements before a failing one may have committed
+	m.recordWrite(ctx, dbID, db, h)
+	if err != nil {
+		return failedQuery[cloudflared1.RawResult](err), nil
 	}
+	return &utils.APIResponse[[]cloudflared1.RawResult]{
+		Result:  raws,
+		Success: true,
+		Errors:  nil,
+	}, nil
+}
+
+// BatchQuery execute statements on the local sqlite db in a single transaction.
+// If any statement fails, the transaction is rolled back.
+func (m *MockClient) BatchQuery(ctx context.Context, dbID string, statements []cloudflared1.Statement) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
+	db, h, ok := m.lock(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	defer h.mu.Unlock()
+	raws, err := runBatch(ctx, db, statements)
+	// statements before a failing one may have committed
+	m.recordWrite(ctx, dbID, db, h)
+	if err != nil {
+		return failedQuery[cloudflared1.QueryResult[any]](err), nil
+	}
+	results := make([]cloudflared1.QueryResult[any], len(raws))
+	for i, raw := range raws {
+		results[i] = toQueryResult(raw)
+	}
+	return &utils.APIResponse[[]cloudflared1.QueryResult[any]]{
+		Result:  results,
+		Success: true,
+		Errors:  nil,
+	}, nil
 }
 
-// query helper to retrieve information from the local sql db
-func (m *MockClient) query(_ context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
-	db, ok := m.ConnMap[dbID]
+// BatchQueryRaw execute statements on the local sqlite db in a single transaction, returning rows as arrays.
+// If any statement fails, the transaction is rolled back.
+func (m *MockClient) BatchQueryRaw(ctx context.Context, dbID string, statements []cloudflared1.Statement) (*utils.APIResponse[[]cloudflared1.RawResult], error) {
+	db, h, ok := m.lock(dbID)
 	if !ok {
-		return nil, fmt.Errorf("Invalid db id: %s", dbID)
+		return nil, errNotFound(dbID)
+	}
+	defer h.mu.Unlock()
+	raws, err := runBatch(ctx, db, statements)
+	m.recordWrite(ctx, dbID, db, h)
+	if err != nil {
+		return failedQuery[cloudflared1.RawResult](err), nil
+	}
+	return &utils.APIResponse[[]cloudflared1.RawResult]{
+		Result:  raws,
+		Success: true,
+		Errors:  nil,
+	}, nil
+}
+
+// runQuery execute query, split into its statements. Several statements are run in one
+// transaction, and parameters can only be bound when there is a single statement.
+func runQuery(ctx context.Context, db *sql.DB, query string, params ...any) ([]cloudflared1.RawResult, error) {
+	statements := utils.SplitStatements(query)
+	if len(statements) <= 1 {
+		raw, err := runSingle(ctx, db, query, params...)
+		if err != nil {
+			return nil, err
+		}
+		return []cloudflared1.RawResult{raw}, nil
+	}
+	if len(params) > 0 {
+		return nil, errors.New("parameters cannot be bound to a query with multiple statements")
+	}
+	batch := make([]cloudflared1.Statement, len(statements))
+	for i, stmt := range statements {
+		batch[i] = cloudflared1.Statement{SQL: stmt}
+	}
+	return runBatch(ctx, db, batch)
+}
+
+// runBatch execute statements in a single transaction, rolling back if any fails
+func runBatch(ctx context.Context, db *sql.DB, statements []cloudflared1.Statement) ([]cloudflared1.RawResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	results := make([]cloudflared1.RawResult, 0, len(statements))
+	for _, stmt := range statements {
+		raw, err := runStatement(ctx, tx, stmt.SQL, stmt.Params...)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, raw)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// runSingle execute a single statement on a connection reserved for it
+func runSingle(ctx context.Context, db *sql.DB, query string, params ...any) (cloudflared1.RawResult, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return cloudflared1.RawResult{}, err
+	}
+	defer conn.Close()
+	return runStatement(ctx, conn, query, params...)
+}
+
+// keepBlobsKey context key set by KeepBlobs
+type keepBlobsKey struct{}
+
+// KeepBlobs return a context under which queries return blobs as []byte. Otherwise they are
+// returned as strings, so results marshal to readable JSON. Servers encoding blobs the way D1
+// does, as arrays of numbers, need the bytes.
+func KeepBlobs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keepBlobsKey{}, true)
+}
+
+// keepsBlobs report whether ctx was returned by KeepBlobs
+func keepsBlobs(ctx context.Context) bool {
+	keep, _ := ctx.Value(keepBlobsKey{}).(bool)
+	return keep
+}
+
+// runStatement execute a single statement against db. Every statement is run as a query, so
+// statements returning rows (SELECT, RETURNING, PRAGMA...) have their rows and columns, and
+// meta is derived from the connection's counters before and after.
+// db must be a single connection or transaction for the counters to belong to this statement.
+func runStatement(ctx context.Context, db execQueryer, query string, params ...any) (cloudflared1.RawResult, error) {
+	before, err := readCounters(ctx, db)
+	if err != nil {
+		return cloudflared1.RawResult{}, err
 	}
-	rows, err := db.Query(query, params...)
+	// tables are counted before the statement runs, so rows deleted by it are counted
+	scanned := estimateScanned(ctx, db, query, params...)
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
-		sqlErr := errToApiResp(err)
-		return &utils.APIResponse[[]cloudflared1.QueryResult[any]]{
-			Result:  []cloudflared1.QueryResult[any]{},
-			Success: false,
-			Errors:  []utils.D1Err{sqlErr},
-		}, nil
+		return cloudflared1.RawResult{}, err
 	}
 	defer rows.Close()
 
 	// Convert rows to result format
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		return cloudflared1.RawResult{}, err
 	}
 
-	var results []any
+	var results [][]any
 	for rows.Next() {
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
@@ -235,109 +597,95 @@ func (m *MockClient) query(_ context.Context, dbID string, query string, params
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, err
+			return cloudflared1.RawResult{}, err
 		}
 
-		// Convert to map with column names as keys
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			// Convert []byte to string for better JSON marshaling
-			if b, ok := values[i].([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = values[i]
+		if !keepsBlobs(ctx) {
+			for i := range values {
+				// Convert []byte to string for better JSON marshaling
+				if b, ok := values[i].([]byte); ok {
+					values[i] = string(b)
+				}
 			}
 		}
-		results = append(results, row)
+		results = append(results, values)
 	}
-
-	meta := cloudflared1.Meta{
-		ChangedDB:       false,
-		Changes:         0,
-		Duration:        0.1,
-		LastRowID:       0,
-		RowsRead:        len(results),
-		RowsWritten:     0,
-		ServedByPrimary: true,
-		ServedByRegion:  "mock-region",
-		SizeAfter:       1024,
-		Timings: &cloudflared1.Timings{
-			SQLDurationMS: 0.1,
-		},
+	if err := rows.Err(); err != nil {
+		return cloudflared1.RawResult{}, err
+	}
+	if err := rows.Close(); err != nil {
+		return cloudflared1.RawResult{}, err
 	}
+	elapsed := time.Since(start)
 
-	queryResult := cloudflared1.QueryResult[any]{
-		Meta:    meta,
-		Results: results,
-		Success: true,
+	after, err := readCounters(ctx, db)
+	if err != nil {
+		return cloudflared1.RawResult{}, err
 	}
 
-	return &utils.APIResponse[[]cloudflared1.QueryResult[any]]{
-		Result:  []cloudflared1.QueryResult[any]{queryResult},
+	return cloudflared1.RawResult{
+		Columns: columns,
+		Rows:    results,
+		Meta:    statementMeta(before, after, len(results), scanned, elapsed),
 		Success: true,
-		Errors:  nil,
 	}, nil
 }
 
-// exec helper to alter the local sql db
-func (m *MockClient) exec(_ context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
-	db, ok := m.ConnMap[dbID]
-	if !ok {
-		return nil, fmt.Errorf("Invalid db id: %s", dbID)
-	}
-	result, err := db.Exec(query, params...)
-	if err != nil {
-		sqlErr := errToApiResp(err)
-		return &utils.APIResponse[[]cloudflared1.QueryResult[any]]{
-			Result:  []cloudflared1.QueryResult[any]{},
-			Success: false,
-			Errors:  []utils.D1Err{sqlErr},
-		}, nil
-	}
-	last, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return nil, err
+// toQueryResult convert a raw result into rows of maps keyed by column name
+func toQueryResult(raw cloudflared1.RawResult) cloudflared1.QueryResult[any] {
+	var results []any
+	for _, values := range raw.Rows {
+		// Convert to map with column names as keys
+		row := make(map[string]interface{})
+		for i, col := range raw.Columns {
+			row[col] = values[i]
+		}
+		results = append(results, row)
 	}
-	meta := cloudflared1.Meta{
-		ChangedDB:       false,
-		Changes:         0,
-		Duration:        0.1,
-		LastRowID:       last,
-		RowsRead:        int(affected),
-		RowsWritten:     int(affected),
-		ServedByPrimary: true,
-		ServedByRegion:  "mock-region",
-		SizeAfter:       1024,
-		Timings: &cloudflared1.Timings{
-			SQLDurationMS: 0.1,
-		},
+	return cloudflared1.QueryResult[any]{
+		Meta:    raw.Meta,
+		Results: results,
+		Success: raw.Success,
 	}
+}
 
-	queryResult := cloudflared1.QueryResult[any]{
-		Meta:    meta,
-		Results: nil,
-		Success: true,
+// failedQuery response for a query which failed to execute
+func failedQuery[T any](err error) *utils.APIResponse[[]T] {
+	return &utils.APIResponse[[]T]{
+		Result:  []T{},
+		Success: false,
+		Errors:  []utils.D1Err{errToApiResp(err)},
 	}
+}
 
-	return &utils.APIResponse[[]cloudflared1.QueryResult[any]]{
-		Result:  []cloudflared1.QueryResult[any]{queryResult},
-		Success: true,
-		Errors:  nil,
-	}, nil
+func (m *MockClient) getDBPath(id string) string {
+	return filepath.Join(m.dbpath, fmt.Sprintf("%s.db", id))
 }
 
-// QueryDBRaw execute a query on the local sqlite db
-func (m *MockClient) QueryDBRaw(ctx context.Context, dbID string, query string, params ...any) (*utils.APIResponse[[]cloudflared1.QueryResult[any]], error) {
-	// For mock, QueryDBRaw behaves the same as QueryDB
-	return m.QueryDB(ctx, dbID, query, params...)
+// errNameExists error returned when creating a database with the name of an existing one
+func errNameExists() error {
+	return &utils.APIError{
+		StatusCode: http.StatusBadRequest,
+		Errors: []utils.D1Err{
+			{
+				Code:    7502,
+				Message: "A database with that name already exists",
+			},
+		},
+	}
 }
 
-func (m *MockClient) getDBPath(id string) string {
-	return filepath.Join(m.dbpath, fmt.Sprintf("%s.db", id))
+// errNotFound error returned when a database id is not known to the mock
+func errNotFound(dbID string) error {
+	return &utils.APIError{
+		StatusCode: http.StatusNotFound,
+		Errors: []utils.D1Err{
+			{
+				Code:    7404,
+				Message: fmt.Sprintf("Invalid db id: %s", dbID),
+			},
+		},
+	}
 }
 
 func errToApiResp(err error) utils.D1Err {
@@ -1,12 +1,20 @@
 package mock
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
 	"github.com/stretchr/testify/assert"
 	_ "modernc.org/sqlite"
 )
@@ -31,7 +39,9 @@ func TestCreateDeleteUpdateDB(t *testing.T) {
 	assert.True(t, createResult.Success)
 	assert.Equal(t, newDBName, createResult.Result.Name)
 	dbID := createResult.Result.UUID
-	assert.Equal(t, dbID.String(), client.NameIDMap[newDBName])
+	lookupID, ok := client.LookupID(newDBName)
+	assert.True(t, ok)
+	assert.Equal(t, dbID.String(), lookupID)
 
 	if !createResult.Success {
 		panic("Test cannot continue, db creation failed")
@@ -74,7 +84,9 @@ func TestEditDBRecords(t *testing.T) {
 	assert.True(t, createResult.Success)
 	assert.Equal(t, newDBName, createResult.Result.Name)
 	dbID := createResult.Result.UUID
-	assert.Equal(t, dbID.String(), client.NameIDMap[newDBName])
+	lookupID, ok := client.LookupID(newDBName)
+	assert.True(t, ok)
+	assert.Equal(t, dbID.String(), lookupID)
 
 	if !createResult.Success {
 		panic("Test cannot continue, db creation failed")
@@ -184,6 +196,797 @@ func TestEditDBRecords(t *testing.T) {
 	assert.Len(t, deleteRes.Errors, 0)
 }
 
+func TestBatchQuery(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	createResult, err := client.CreateDB(ctx, "batch")
+	assert.NoError(t, err)
+	dbID := createResult.Result.UUID.String()
+
+	// successful batch returns one result per statement
+	resp, err := client.BatchQuery(ctx, dbID, []cloudflared1.Statement{
+		{SQL: "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT UNIQUE)"},
+		{SQL: "INSERT INTO users (name) VALUES (?)", Params: []any{"alice"}},
+		{SQL: "INSERT INTO users (name) VALUES (?)", Params: []any{"bob"}},
+		{SQL: "SELECT name FROM users ORDER BY id"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Len(t, resp.Result, 4)
+	assert.EqualValues(t, 2, resp.Result[2].Meta.LastRowID)
+	assert.Len(t, resp.Result[3].Results, 2)
+
+	// failing batch rolls back every statement
+	resp, err = client.BatchQuery(ctx, dbID, []cloudflared1.Statement{
+		{SQL: "INSERT INTO users (name) VALUES (?)", Params: []any{"carol"}},
+		{SQL: "INSERT INTO users (name) VALUES (?)", Params: []any{"alice"}},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+	assert.Len(t, resp.Errors, 1)
+	assert.ErrorIs(t, resp.Err(), utils.ErrConstraint)
+
+	resp, err = client.QueryDB(ctx, dbID, "SELECT name FROM users")
+	assert.NoError(t, err)
+	assert.Len(t, resp.Result[0].Results, 2)
+
+	raw, err := client.BatchQueryRaw(ctx, dbID, []cloudflared1.Statement{
+		{SQL: "INSERT INTO users (name) VALUES (?)", Params: []any{"carol"}},
+		{SQL: "SELECT id, name FROM users ORDER BY id"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, raw.Success)
+	assert.Len(t, raw.Result, 2)
+	assert.Equal(t, []string{"id", "name"}, raw.Result[1].Columns)
+	assert.Equal(t, [][]any{{int64(1), "alice"}, {int64(2), "bob"}, {int64(3), "carol"}}, raw.Result[1].Rows)
+}
+
+func TestQueryDBRaw(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	createResult, err := client.CreateDB(ctx, "raw")
+	assert.NoError(t, err)
+	dbID := createResult.Result.UUID.String()
+
+	_, err = client.BatchQuery(ctx, dbID, []cloudflared1.Statement{
+		{SQL: "CREATE TABLE a (id INTEGER PRIMARY KEY, name TEXT)"},
+		{SQL: "CREATE TABLE b (id INTEGER PRIMARY KEY, a_id INTEGER, name TEXT)"},
+		{SQL: "INSERT INTO a (id, name) VALUES (1, 'parent')"},
+		{SQL: "INSERT INTO b (id, a_id, name) VALUES (7, 1, 'child')"},
+	})
+	assert.NoError(t, err)
+
+	// duplicate column names from a join are preserved in order
+	resp, err := client.QueryDBRaw(ctx, dbID, "SELECT a.name, b.name, b.id FROM a JOIN b ON b.a_id = a.id")
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Len(t, resp.Result, 1)
+	assert.Equal(t, []string{"name", "name", "id"}, resp.Result[0].Columns)
+	assert.Equal(t, [][]any{{"parent", "child", int64(7)}}, resp.Result[0].Rows)
+
+	// blobs are returned as strings, or as bytes under KeepBlobs
+	resp, err = client.QueryDBRaw(ctx, dbID, "SELECT x'6869'")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]any{{"hi"}}, resp.Result[0].Rows)
+	resp, err = client.QueryDBRaw(KeepBlobs(ctx), dbID, "SELECT x'6869'")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]any{{[]byte("hi")}}, resp.Result[0].Rows)
+
+	// invalid query
+	resp, err = client.QueryDBRaw(ctx, dbID, "SELECT * FROM missing")
+	assert.NoError(t, err)
+	assert.False(t, resp.Success)
+	assert.Len(t, resp.Errors, 1)
+}
+
+func TestConcurrentUse(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	// a shared database written to by every goroutine
+	shared, err := client.CreateDB(ctx, "shared")
+	assert.NoError(t, err)
+	sharedID := shared.Result.UUID.String()
+	resp, err := client.QueryDB(ctx, sharedID, "CREATE TABLE events (id INTEGER PRIMARY KEY, worker INTEGER)")
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("worker-%d", w)
+			created, err := client.CreateDB(ctx, name)
+			if !assert.NoError(t, err) {
+				return
+			}
+			dbID := created.Result.UUID.String()
+			id, ok := client.LookupID(name)
+			assert.True(t, ok)
+			assert.Equal(t, dbID, id)
+
+			for range 5 {
+				resp, err := client.QueryDB(ctx, sharedID, "INSERT INTO events (worker) VALUES (?)", w)
+				assert.NoError(t, err)
+				assert.True(t, resp.Success)
+				_, err = client.ListDB(ctx)
+				assert.NoError(t, err)
+				_, err = client.GetDB(ctx, sharedID)
+				assert.NoError(t, err)
+			}
+
+			_, err = client.DeleteDB(ctx, dbID)
+			assert.NoError(t, err)
+			_, ok = client.LookupID(name)
+			assert.False(t, ok)
+		}()
+	}
+	wg.Wait()
+
+	resp, err = client.QueryDB(ctx, sharedID, "SELECT count(*) AS n FROM events")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{map[string]any{"n": int64(workers * 5)}}, resp.Result[0].Results)
+	list, err := client.ListDB(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list.Result, 1)
+}
+
+func TestResolveID(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	created, err := client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := created.Result.UUID.String()
+
+	id, err := client.ResolveID(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, dbID, id)
+	id, err = client.ResolveID(ctx, dbID)
+	assert.NoError(t, err)
+	assert.Equal(t, dbID, id)
+
+	res, err := client.GetDBByName(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, created.Result.UUID, res.Result.UUID)
+
+	_, err = client.DeleteDB(ctx, dbID)
+	assert.NoError(t, err)
+	_, err = client.ResolveID(ctx, "orders")
+	assert.ErrorIs(t, err, utils.ErrNotFound)
+	_, err = client.GetDBByName(ctx, "orders")
+	assert.ErrorIs(t, err, utils.ErrNotFound)
+}
+
+func TestListDBPagination(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	for _, name := range []string{"orders", "orders-archive", "users", "events", "orders-eu"} {
+		_, err := client.CreateDB(ctx, name)
+		assert.NoError(t, err)
+	}
+
+	res, err := client.ListDB(ctx, cloudflared1.ListPage(2), cloudflared1.ListPerPage(2))
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Len(t, res.Result, 2)
+	assert.Equal(t, "orders-archive", res.Result[0].Name)
+	assert.Equal(t, "orders-eu", res.Result[1].Name)
+	assert.Equal(t, &utils.ResultInfo{Page: 2, PerPage: 2, Count: 2, TotalCount: 5}, res.ResultInfo)
+
+	res, err = client.ListDB(ctx, cloudflared1.ListByName("ORDERS"))
+	assert.NoError(t, err)
+	assert.Len(t, res.Result, 3)
+	assert.Equal(t, 3, res.ResultInfo.TotalCount)
+
+	// pages past the end are empty
+	res, err = client.ListDB(ctx, cloudflared1.ListPage(10))
+	assert.NoError(t, err)
+	assert.Len(t, res.Result, 0)
+
+	// databases which cannot be read are skipped without being counted
+	id, _ := client.LookupID("orders")
+	assert.NoError(t, client.conns[id].Close())
+	res, err = client.ListDB(ctx, cloudflared1.ListPage(2), cloudflared1.ListPerPage(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders-eu", res.Result[0].Name)
+	assert.Equal(t, "users", res.Result[1].Name)
+	assert.Equal(t, &utils.ResultInfo{Page: 2, PerPage: 2, Count: 2, TotalCount: 4}, res.ResultInfo)
+}
+
+func TestCreateDBWithOptions(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	res, err := client.CreateDBWithOptions(ctx, "eu-orders", cloudflared1.CreateDBOptions{
+		PrimaryLocationHint: cloudflared1.LocationWesternEurope,
+		Jurisdiction:        cloudflared1.JurisdictionEU,
+	})
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Equal(t, cloudflared1.LocationWesternEurope, res.Result.PrimaryLocationHint)
+	assert.Equal(t, cloudflared1.JurisdictionEU, res.Result.Jurisdiction)
+
+	getRes, err := client.GetDB(ctx, res.Result.UUID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, cloudflared1.LocationWesternEurope, getRes.Result.PrimaryLocationHint)
+	assert.Equal(t, cloudflared1.JurisdictionEU, getRes.Result.Jurisdiction)
+
+	// plain CreateDB leaves placement unset
+	res, err = client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Empty(t, res.Result.PrimaryLocationHint)
+	assert.Empty(t, res.Result.Jurisdiction)
+}
+
+func TestTimeTravel(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	res, err := client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := res.Result.UUID.String()
+
+	_, err = client.QueryDB(ctx, dbID, "CREATE TABLE orders (id INTEGER PRIMARY KEY, item TEXT)")
+	assert.NoError(t, err)
+	_, err = client.QueryDB(ctx, dbID, "INSERT INTO orders (item) VALUES ('apple')")
+	assert.NoError(t, err)
+	before, err := client.GetBookmark(ctx, dbID)
+	assert.NoError(t, err)
+	assert.True(t, before.Success)
+	assert.NotEmpty(t, before.Result.Bookmark)
+	checkpoint := time.Now()
+
+	// reads do not move the bookmark
+	_, err = client.QueryDB(ctx, dbID, "SELECT * FROM orders")
+	assert.NoError(t, err)
+	again, err := client.GetBookmark(ctx, dbID)
+	assert.NoError(t, err)
+	assert.Equal(t, before.Result.Bookmark, again.Result.Bookmark)
+
+	_, err = client.QueryDB(ctx, dbID, "DELETE FROM orders")
+	assert.NoError(t, err)
+	after, err := client.GetBookmark(ctx, dbID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, before.Result.Bookmark, after.Result.Bookmark)
+
+	at, err := client.GetBookmarkAt(ctx, dbID, checkpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, before.Result.Bookmark, at.Result.Bookmark)
+
+	count := func() int {
+		n, _, err := cloudflared1.QueryOne[int](ctx, client, dbID, "SELECT count(*) FROM orders")
+		assert.NoError(t, err)
+		return n
+	}
+
+	restored, err := client.RestoreBookmark(ctx, dbID, before.Result.Bookmark)
+	assert.NoError(t, err)
+	assert.True(t, restored.Success)
+	assert.Equal(t, before.Result.Bookmark, restored.Result.Bookmark)
+	assert.Equal(t, after.Result.Bookmark, restored.Result.PreviousBookmark)
+	assert.Equal(t, 1, count())
+
+	// undo the restore
+	undo, err := client.RestoreBookmark(ctx, dbID, restored.Result.PreviousBookmark)
+	assert.NoError(t, err)
+	assert.True(t, undo.Success)
+	assert.Equal(t, 0, count())
+
+	restored, err = client.RestoreTimestamp(ctx, dbID, checkpoint)
+	assert.NoError(t, err)
+	assert.True(t, restored.Success)
+	assert.Equal(t, 1, count())
+
+	// before the database existed
+	missing, err := client.RestoreTimestamp(ctx, dbID, checkpoint.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, missing.Success)
+	missing, err = client.RestoreBookmark(ctx, dbID, "not-a-bookmark")
+	assert.NoError(t, err)
+	assert.False(t, missing.Success)
+
+	// every write is copied, so states never bookmarked can be restored
+	_, err = client.QueryDB(ctx, dbID, "INSERT INTO orders (item) VALUES (?)", "pear")
+	assert.NoError(t, err)
+	unbookmarked := time.Now()
+	_, err = client.QueryDB(ctx, dbID, "DELETE FROM orders")
+	assert.NoError(t, err)
+	restored, err = client.RestoreTimestamp(ctx, dbID, unbookmarked)
+	assert.NoError(t, err)
+	assert.True(t, restored.Success)
+	items, _, err := cloudflared1.Query[string](ctx, client, dbID, "SELECT item FROM orders ORDER BY id")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"apple", "pear"}, items)
+
+	// writes after a restore have a bookmark of their own
+	_, err = client.QueryDB(ctx, dbID, "DELETE FROM orders")
+	assert.NoError(t, err)
+	latest, err := client.GetBookmark(ctx, dbID)
+	assert.NoError(t, err)
+	for _, bookmark := range []string{before.Result.Bookmark, after.Result.Bookmark, restored.Result.Bookmark, restored.Result.PreviousBookmark} {
+		assert.NotEqual(t, bookmark, latest.Result.Bookmark)
+	}
+}
+
+func TestTimeTravelSnapshots(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	res, err := client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := res.Result.UUID.String()
+	copies := func() int {
+		entries, err := os.ReadDir(client.historyDir(dbID))
+		assert.NoError(t, err)
+		return len(entries)
+	}
+
+	// restored states hold the values written, not ones generated again
+	_, err = client.QueryDB(ctx, dbID, "CREATE TABLE orders (id INTEGER PRIMARY KEY, n INTEGER)")
+	assert.NoError(t, err)
+	_, err = client.QueryDB(ctx, dbID, "INSERT INTO orders (n) VALUES (random())")
+	assert.NoError(t, err)
+	n, _, err := cloudflared1.QueryOne[int64](ctx, client, dbID, "SELECT n FROM orders")
+	assert.NoError(t, err)
+	checkpoint := time.Now()
+	_, err = client.QueryDB(ctx, dbID, "UPDATE orders SET n = random()")
+	assert.NoError(t, err)
+	restored, err := client.RestoreTimestamp(ctx, dbID, checkpoint)
+	assert.NoError(t, err)
+	assert.True(t, restored.Success)
+	got, _, err := cloudflared1.QueryOne[int64](ctx, client, dbID, "SELECT n FROM orders")
+	assert.NoError(t, err)
+	assert.Equal(t, n, got)
+
+	// writes which change no rows or schema are kept too
+	_, err = client.QueryDB(ctx, dbID, "PRAGMA user_version = 7")
+	assert.NoError(t, err)
+	checkpoint = time.Now()
+	_, err = client.QueryDB(ctx, dbID, "PRAGMA user_version = 8")
+	assert.NoError(t, err)
+	_, err = client.RestoreTimestamp(ctx, dbID, checkpoint)
+	assert.NoError(t, err)
+	version, _, err := cloudflared1.QueryOne[int](ctx, client, dbID, "PRAGMA user_version")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, version)
+
+	// reads and writes changing nothing are not copied
+	points := len(client.histories[dbID].points)
+	_, err = client.QueryDB(ctx, dbID, "SELECT * FROM orders")
+	assert.NoError(t, err)
+	_, err = client.QueryDB(ctx, dbID, "UPDATE orders SET n = 0 WHERE id = -1")
+	assert.NoError(t, err)
+	assert.Equal(t, points, len(client.histories[dbID].points))
+
+	// the oldest points and their copies are discarded
+	start := time.Now()
+	for i := range historyLimit {
+		_, err := client.QueryDB(ctx, dbID, "INSERT INTO orders (n) VALUES (?)", i)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, historyLimit, len(client.histories[dbID].points))
+	assert.Equal(t, historyLimit, copies())
+	at, err := client.GetBookmarkAt(ctx, dbID, start)
+	assert.NoError(t, err)
+	assert.False(t, at.Success)
+}
+
+func TestTimeTravelConcurrentRestore(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	res, err := client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := res.Result.UUID.String()
+	_, err = client.QueryDB(ctx, dbID, "CREATE TABLE orders (id INTEGER PRIMARY KEY, n INTEGER)")
+	assert.NoError(t, err)
+	bookmark, err := client.GetBookmark(ctx, dbID)
+	assert.NoError(t, err)
+
+	// queries running while the database is restored wait for it rather than failing
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				res, err := client.QueryDB(ctx, dbID, "INSERT INTO orders (n) VALUES (?)", i)
+				assert.NoError(t, err)
+				assert.True(t, res.Success)
+				_, _, err = cloudflared1.QueryOne[int](ctx, client, dbID, "SELECT count(*) FROM orders")
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	for range 20 {
+		restored, err := client.RestoreBookmark(ctx, dbID, bookmark.Result.Bookmark)
+		assert.NoError(t, err)
+		assert.True(t, restored.Success)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestExport(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	res, err := client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := res.Result.UUID.String()
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, score REAL, avatar BLOB)",
+		"CREATE INDEX users_name ON users (name)",
+		"CREATE TABLE notes (body TEXT)",
+		"INSERT INTO users (name, score, avatar) VALUES ('o''brien', 1.0, x'cafe')",
+		"INSERT INTO users (name, score, avatar) VALUES (NULL, 2.5, NULL)",
+		"INSERT INTO notes (body) VALUES ('hello')",
+	} {
+		res, err := client.QueryDB(ctx, dbID, stmt)
+		assert.NoError(t, err)
+		assert.True(t, res.Success, stmt)
+	}
+
+	var buf bytes.Buffer
+	var progress, size int64
+	exportRes, err := client.Export(ctx, dbID, &buf, cloudflared1.ExportOptions{
+		Progress: func(done, total int64) {
+			progress, size = done, total
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, exportRes.Success)
+	assert.Equal(t, cloudflared1.OperationComplete, exportRes.Result.Status)
+	assert.NotEmpty(t, exportRes.Result.AtBookmark)
+	assert.Equal(t, int64(buf.Len()), progress)
+	assert.Equal(t, int64(buf.Len()), size)
+	assert.Equal(t, `PRAGMA defer_foreign_keys=TRUE;
+CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, score REAL, avatar BLOB);
+INSERT INTO "users" ("id","name","score","avatar") VALUES(1,'o''brien',1.0,X'CAFE');
+INSERT INTO "users" ("id","name","score","avatar") VALUES(2,NULL,2.5,NULL);
+CREATE TABLE notes (body TEXT);
+INSERT INTO "notes" ("body") VALUES('hello');
+DELETE FROM sqlite_sequence WHERE name = 'users';
+INSERT INTO sqlite_sequence (name, seq) VALUES('users', 2);
+CREATE INDEX users_name ON users (name);
+`, buf.String())
+
+	buf.Reset()
+	_, err = client.Export(ctx, dbID, &buf, cloudflared1.ExportOptions{NoData: true, Tables: []string{"notes"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "PRAGMA defer_foreign_keys=TRUE;\nCREATE TABLE notes (body TEXT);\n", buf.String())
+
+	buf.Reset()
+	_, err = client.Export(ctx, dbID, &buf, cloudflared1.ExportOptions{NoSchema: true, Tables: []string{"notes"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "PRAGMA defer_foreign_keys=TRUE;\nINSERT INTO \"notes\" (\"body\") VALUES('hello');\n", buf.String())
+}
+
+func TestImportSQL(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	source, err := client.CreateDB(ctx, "source")
+	assert.NoError(t, err)
+	sourceID := source.Result.UUID.String()
+	_, err = client.BatchQuery(ctx, sourceID, []cloudflared1.Statement{
+		{SQL: "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)"},
+		{SQL: "INSERT INTO users (name) VALUES ('alice; bob'), ('carol')"},
+	})
+	assert.NoError(t, err)
+	var dump bytes.Buffer
+	_, err = client.Export(ctx, sourceID, &dump, cloudflared1.ExportOptions{})
+	assert.NoError(t, err)
+
+	// restore the dump into a new database
+	target, err := client.CreateDB(ctx, "target")
+	assert.NoError(t, err)
+	targetID := target.Result.UUID.String()
+	var uploaded int64
+	res, err := client.ImportSQL(ctx, targetID, bytes.NewReader(dump.Bytes()), cloudflared1.ImportOptions{
+		Progress: func(done, total int64) {
+			uploaded = done
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Equal(t, cloudflared1.OperationComplete, res.Result.Status)
+	assert.Equal(t, int64(dump.Len()), uploaded)
+	assert.NotEqual(t, res.Result.AtBookmark, res.Result.Result.FinalBookmark)
+	names, _, err := cloudflared1.Query[string](ctx, client, targetID, "SELECT name FROM users ORDER BY id")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice; bob", "carol"}, names)
+
+	// a failing import is rolled back
+	res, err = client.ImportSQL(ctx, targetID, strings.NewReader("INSERT INTO users (name) VALUES ('dave'); INSERT INTO missing VALUES (1);"), cloudflared1.ImportOptions{})
+	assert.NoError(t, err)
+	assert.False(t, res.Success)
+	assert.Len(t, res.Errors, 1)
+	assert.Contains(t, res.Errors[0].Message, "no such table")
+	assert.False(t, res.Result.Success)
+	assert.Equal(t, cloudflared1.OperationError, res.Result.Status)
+	assert.Contains(t, res.Result.Error, "no such table")
+	assert.Nil(t, res.Result.Result)
+	count, _, err := cloudflared1.QueryOne[int](ctx, client, targetID, "SELECT count(*) FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestStatementClassification(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	res, err := client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := res.Result.UUID.String()
+	run := func(query string) cloudflared1.RawResult {
+		res, err := client.QueryDBRaw(ctx, dbID, query)
+		assert.NoError(t, err)
+		assert.True(t, res.Success, query)
+		assert.Len(t, res.Result, 1)
+		return res.Result[0]
+	}
+
+	run("CREATE TABLE items (id INTEGER PRIMARY KEY, selected INTEGER)")
+	run("CREATE TABLE archive (id INTEGER PRIMARY KEY, selected INTEGER)")
+
+	// a column named selected does not turn an insert into a query
+	res1 := run("INSERT INTO items (selected) VALUES (1), (0), (1)")
+	assert.Equal(t, 3, res1.Meta.Changes)
+	assert.Equal(t, int64(3), res1.Meta.LastRowID)
+	assert.True(t, res1.Meta.ChangedDB)
+
+	// writes containing SELECT keep their meta
+	res1 = run("INSERT INTO archive (id, selected) SELECT id, selected FROM items WHERE selected = 1")
+	assert.Equal(t, 2, res1.Meta.Changes)
+	assert.Equal(t, int64(3), res1.Meta.LastRowID)
+	res1 = run("UPDATE items SET selected = 0 WHERE id IN (SELECT id FROM archive)")
+	assert.Equal(t, 2, res1.Meta.Changes)
+
+	// statements producing rows return them
+	res1 = run("INSERT INTO items (selected) VALUES (5) RETURNING id, selected")
+	assert.Equal(t, []string{"id", "selected"}, res1.Columns)
+	assert.Equal(t, [][]any{{int64(4), int64(5)}}, res1.Rows)
+	assert.Equal(t, 1, res1.Meta.Changes)
+	assert.Equal(t, int64(4), res1.Meta.LastRowID)
+	res1 = run("PRAGMA table_info(items)")
+	assert.Contains(t, res1.Columns, "name")
+	assert.Len(t, res1.Rows, 2)
+	res1 = run("WITH old AS (SELECT id FROM archive) DELETE FROM items WHERE id IN (SELECT id FROM old) RETURNING id")
+	assert.Equal(t, [][]any{{int64(1)}, {int64(3)}}, res1.Rows)
+	assert.Equal(t, 2, res1.Meta.Changes)
+
+	// reads report no changes, even straight after a write
+	res1 = run("SELECT * FROM items")
+	assert.Equal(t, 0, res1.Meta.Changes)
+	assert.False(t, res1.Meta.ChangedDB)
+	assert.Len(t, res1.Rows, 2)
+}
+
+func TestMultiStatementQuery(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	res, err := client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := res.Result.UUID.String()
+
+	raw, err := client.QueryDBRaw(ctx, dbID, `
+		CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE audit (item_id INTEGER);
+		-- record every insert; including this one
+		CREATE TRIGGER items_audit AFTER INSERT ON items BEGIN
+			INSERT INTO audit VALUES (new.id);
+		END;
+		INSERT INTO items (name) VALUES ('a;b'), ('c');
+		SELECT name FROM items ORDER BY id;
+	`)
+	assert.NoError(t, err)
+	assert.True(t, raw.Success)
+	assert.Len(t, raw.Result, 5)
+	assert.Equal(t, 2, raw.Result[3].Meta.Changes)
+	assert.Equal(t, int64(2), raw.Result[3].Meta.LastRowID)
+	assert.Equal(t, [][]any{{"a;b"}, {"c"}}, raw.Result[4].Rows)
+
+	query, err := client.QueryDB(ctx, dbID, "SELECT count(*) AS n FROM audit; SELECT count(*) AS n FROM items")
+	assert.NoError(t, err)
+	assert.Len(t, query.Result, 2)
+	assert.Equal(t, []any{map[string]any{"n": int64(2)}}, query.Result[0].Results)
+
+	// a failing statement rolls back the ones before it
+	query, err = client.QueryDB(ctx, dbID, "INSERT INTO items (name) VALUES ('d'); INSERT INTO missing VALUES (1)")
+	assert.NoError(t, err)
+	assert.False(t, query.Success)
+	count, _, err := cloudflared1.QueryOne[int](ctx, client, dbID, "SELECT count(*) FROM items")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// parameters need a single statement
+	query, err = client.QueryDB(ctx, dbID, "SELECT ?; SELECT ?", 1, 2)
+	assert.NoError(t, err)
+	assert.False(t, query.Success)
+}
+
+func TestQueryMeta(t *testing.T) {
+	client, err := NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	res, err := client.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	dbID := res.Result.UUID.String()
+	run := func(query string) cloudflared1.Meta {
+		res, err := client.QueryDBRaw(ctx, dbID, query)
+		assert.NoError(t, err)
+		assert.True(t, res.Success, query)
+		return res.Result[len(res.Result)-1].Meta
+	}
+
+	// schema changes change the database without changing rows
+	meta := run("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)")
+	assert.True(t, meta.ChangedDB)
+	assert.Equal(t, 0, meta.Changes)
+	assert.Equal(t, 0, meta.RowsWritten)
+
+	meta = run("INSERT INTO items (name) VALUES ('a'), ('b'), ('c'), ('d')")
+	assert.True(t, meta.ChangedDB)
+	assert.Equal(t, 4, meta.Changes)
+	assert.Equal(t, 4, meta.RowsWritten)
+	assert.GreaterOrEqual(t, meta.Duration, 0.0)
+	assert.Equal(t, meta.Duration, meta.Timings.SQLDurationMS)
+
+	// the size reported is the size of the database file
+	info, err := client.GetDB(ctx, dbID)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Result.FileSize, meta.SizeAfter)
+
+	meta = run("SELECT * FROM items")
+	assert.False(t, meta.ChangedDB)
+	assert.Equal(t, 4, meta.RowsRead)
+	assert.Equal(t, 0, meta.RowsWritten)
+	// a primary key lookup reads only the matching row
+	meta = run("SELECT * FROM items WHERE id = 2")
+	assert.Equal(t, 1, meta.RowsRead)
+
+	// full scans read every row, even when returning one or none
+	run("WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 10000) INSERT INTO items (name) SELECT 'n' || i FROM n")
+	meta = run("SELECT count(*) FROM items")
+	assert.Equal(t, 10004, meta.RowsRead)
+	meta = run("SELECT * FROM items WHERE name = 'n500'")
+	assert.Equal(t, 10004, meta.RowsRead)
+	// rows deleted by a scan are counted as read
+	meta = run("DELETE FROM items WHERE name GLOB 'n*'")
+	assert.Equal(t, 10000, meta.Changes)
+	assert.Equal(t, 10004, meta.RowsRead)
+
+	// trigger writes count towards rows written but not changes
+	run("CREATE TABLE audit (item_id INTEGER)")
+	run("CREATE TRIGGER items_audit AFTER UPDATE ON items BEGIN INSERT INTO audit VALUES (new.id); END")
+	meta = run("UPDATE items SET name = 'z' WHERE id <= 2")
+	assert.Equal(t, 2, meta.Changes)
+	assert.Equal(t, 4, meta.RowsWritten)
+	assert.Equal(t, 2, meta.RowsRead)
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	client, err := NewMockClient(dir)
+	assert.NoError(t, err)
+	created, err := client.CreateDBWithOptions(ctx, "orders", cloudflared1.CreateDBOptions{
+		PrimaryLocationHint: cloudflared1.LocationAsiaPacific,
+	})
+	assert.NoError(t, err)
+	dbID := created.Result.UUID.String()
+	_, err = client.QueryDB(ctx, dbID, "CREATE TABLE items (id INTEGER PRIMARY KEY); INSERT INTO items VALUES (7)")
+	assert.NoError(t, err)
+	updated, err := client.UpdateDB(ctx, dbID, cloudflared1.DBSettings{Replication: cloudflared1.ReadReplicationModeAuto})
+	assert.NoError(t, err)
+	assert.True(t, updated.Success)
+	assert.Equal(t, cloudflared1.ReadReplicationModeAuto, updated.Result.ReadReplication.Mode)
+	scratch, err := client.CreateDB(ctx, "scratch")
+	assert.NoError(t, err)
+	assert.NoError(t, client.Close())
+	assert.FileExists(t, filepath.Join(dir, registryFile))
+
+	// remove a database file behind the registry's back
+	assert.NoError(t, os.Remove(filepath.Join(dir, scratch.Result.UUID.String()+".db")))
+
+	// a new client finds the database again
+	client, err = NewMockClient(dir)
+	assert.NoError(t, err)
+	defer client.Close()
+	res, err := client.GetDBByName(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, created.Result.CreatedAt, res.Result.CreatedAt)
+	assert.Equal(t, cloudflared1.LocationAsiaPacific, res.Result.PrimaryLocationHint)
+	assert.Equal(t, cloudflared1.ReadReplicationModeAuto, res.Result.ReadReplication.Mode)
+	assert.Equal(t, 1, res.Result.NumTables)
+	id, _, err := cloudflared1.QueryOne[int](ctx, client, dbID, "SELECT id FROM items")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, id)
+	list, err := client.ListDB(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list.Result, 1)
+
+	// the registry is removed with the last database
+	_, err = client.DeleteDB(ctx, dbID)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, registryFile))
+}
+
+func TestRegistrySharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	first, err := NewMockClient(dir)
+	assert.NoError(t, err)
+	defer first.Close()
+	second, err := NewMockClient(dir)
+	assert.NoError(t, err)
+	defer second.Close()
+
+	// clients on the same directory keep each other's databases in the registry
+	_, err = first.CreateDB(ctx, "orders")
+	assert.NoError(t, err)
+	_, err = second.CreateDB(ctx, "users")
+	assert.NoError(t, err)
+	records, err := first.loadRegistry()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	// names are unique across both, as they are in D1
+	for _, client := range []*MockClient{first, second} {
+		_, err = client.CreateDB(ctx, "orders")
+		var apiErr *utils.APIError
+		assert.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 400, apiErr.StatusCode)
+		assert.Equal(t, 7502, apiErr.Errors[0].Code)
+	}
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	dbFiles := 0
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".db") {
+			dbFiles++
+		}
+	}
+	assert.Equal(t, 2, dbFiles)
+
+	third, err := NewMockClient(dir)
+	assert.NoError(t, err)
+	defer third.Close()
+	list, err := third.ListDB(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list.Result, 2)
+}
+
 func randomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, length)
@@ -0,0 +1,137 @@
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+)
+
+// registryFile name of the file in the mock directory recording each database's metadata
+const registryFile = "mock-registry.json"
+
+// dbRecord metadata of a mock database which is not stored in its sqlite file
+type dbRecord struct {
+	UUID                string                       `json:"uuid"`
+	Name                string                       `json:"name"`
+	CreatedAt           string                       `json:"created_at"`
+	ReadReplication     cloudflared1.ReadReplication `json:"read_replication"`
+	PrimaryLocationHint cloudflared1.LocationHint    `json:"primary_location_hint,omitempty"`
+	Jurisdiction        cloudflared1.Jurisdiction    `json:"jurisdiction,omitempty"`
+}
+
+// registry contents of the registry file
+type registry struct {
+	Databases []dbRecord `json:"databases"`
+}
+
+// registryPath location of the registry file
+func (m *MockClient) registryPath() string {
+	return filepath.Join(m.dbpath, registryFile)
+}
+
+// loadRegistry read the databases recorded in the mock directory, if any
+func (m *MockClient) loadRegistry() ([]dbRecord, error) {
+	data, err := os.ReadFile(m.registryPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reg registry
+	if err := json.Unmarshal(data, &reg); err != nil {
+		return nil, err
+	}
+	return reg.Databases, nil
+}
+
+// staleRegistryLock age after which a registry lock is assumed to be left behind by a process
+// which exited while holding it. Updates hold the lock for milliseconds.
+const staleRegistryLock = 10 * time.Second
+
+// lockRegistry take the lock on the registry file, shared with other clients on the same
+// directory. The returned function releases it.
+func (m *MockClient) lockRegistry() (func(), error) {
+	path := m.registryPath() + ".lock"
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > staleRegistryLock {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// updateRegistry apply change to the databases recorded in the registry file, by id. The file
+// is reloaded under a lock first, so clients sharing the directory keep each other's databases
+// rather than the last write winning. The registry is not written if change fails.
+func (m *MockClient) updateRegistry(change func(records map[string]dbRecord) error) error {
+	unlock, err := m.lockRegistry()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	loaded, err := m.loadRegistry()
+	if err != nil {
+		return err
+	}
+	records := make(map[string]dbRecord, len(loaded))
+	for _, rec := range loaded {
+		records[rec.UUID] = rec
+	}
+	if err := change(records); err != nil {
+		return err
+	}
+	return m.writeRegistry(records)
+}
+
+// writeRegistry write records to the registry file, or remove it when there are none so an
+// unused directory is left clean. The registry lock must be held.
+func (m *MockClient) writeRegistry(records map[string]dbRecord) error {
+	if len(records) == 0 {
+		if err := os.Remove(m.registryPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	reg := registry{Databases: make([]dbRecord, 0, len(records))}
+	for _, rec := range records {
+		reg.Databases = append(reg.Databases, rec)
+	}
+	slices.SortFunc(reg.Databases, func(a, b dbRecord) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write then rename so a crash never leaves a truncated registry
+	tmp, err := os.CreateTemp(m.dbpath, registryFile+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.registryPath())
+}
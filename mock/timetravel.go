@@ -0,0 +1,341 @@
+package mock
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+// historyLimit number of points kept per database
+const historyLimit = 100
+
+var _ cloudflared1.TimeTraveler = (*MockClient)(nil)
+
+// point state of a database after a write, which a bookmark refers to
+type point struct {
+	version int
+	at      time.Time
+	// path copy of the database at this point. Points made by a restore share the copy of the
+	// point they restored.
+	path string
+}
+
+// history points of a single database, emulating D1 Time Travel. The database is copied as
+// each write commits, so every bookmark refers to a copy of the state it was taken at.
+type history struct {
+	// mu is held while the database is in use, so a point is copied before the next write runs
+	// and a restore never replaces the database under a running query
+	mu sync.Mutex
+	// version count of the points recorded. It is kept by the mock, as sqlite's change
+	// counters are per connection and start over whenever the database is reopened.
+	version int
+	// counter file change counter of the database at the latest point
+	counter uint32
+	points  []point
+}
+
+// historyOf return the history of a database by id
+func (m *MockClient) historyOf(dbID string) (*history, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h, ok := m.histories[dbID]
+	return h, ok
+}
+
+// lock return the open connection and history of a database, with h.mu held until the caller
+// unlocks it
+func (m *MockClient) lock(dbID string) (*sql.DB, *history, bool) {
+	h, ok := m.historyOf(dbID)
+	if !ok {
+		return nil, nil, false
+	}
+	h.mu.Lock()
+	m.mu.RLock()
+	db, ok := m.conns[dbID]
+	m.mu.RUnlock()
+	if !ok {
+		h.mu.Unlock()
+		return nil, nil, false
+	}
+	return db, h, true
+}
+
+// historyDir directory holding the copies of a database
+func (m *MockClient) historyDir(dbID string) string {
+	return filepath.Join(m.dbpath, fmt.Sprintf("%s.history", dbID))
+}
+
+// pointPath path of the copy of a database at version
+func (m *MockClient) pointPath(dbID string, version int) string {
+	return filepath.Join(m.historyDir(dbID), fmt.Sprintf("%08d.db", version))
+}
+
+// bookmark of a database at version
+func bookmark(dbID string, version int) string {
+	return fmt.Sprintf("%08x-%s", version, strings.ReplaceAll(dbID, "-", ""))
+}
+
+// newHistory start the history of a database with a copy of its current state, discarding
+// any earlier history
+func (m *MockClient) newHistory(ctx context.Context, dbID string, db *sql.DB) (*history, error) {
+	if err := os.RemoveAll(m.historyDir(dbID)); err != nil {
+		return nil, err
+	}
+	h := &history{}
+	if err := m.snapshot(ctx, dbID, db, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// changeCounter read the file change counter from the header of the database file at path,
+// which sqlite increments on every commit changing the file. Statements writing nothing, such
+// as an UPDATE matching no rows, leave it as it is. A database not yet written to disk, or
+// written empty, has a counter of 0.
+func changeCounter(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var header [4]byte
+	if _, err := f.ReadAt(header[:], 24); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(header[:]), nil
+}
+
+// snapshot copy the database as a new point if it has changed since the latest point.
+// h.mu must be held.
+func (m *MockClient) snapshot(ctx context.Context, dbID string, db *sql.DB, h *history) error {
+	counter, err := changeCounter(m.getDBPath(dbID))
+	if err != nil {
+		return err
+	}
+	if len(h.points) > 0 && counter == h.counter {
+		return nil
+	}
+	if err := os.MkdirAll(m.historyDir(dbID), 0o755); err != nil {
+		return err
+	}
+	version := h.version + 1
+	path := m.pointPath(dbID, version)
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	h.version, h.counter = version, counter
+	h.points = append(h.points, point{version: version, at: time.Now(), path: path})
+	m.trim(h)
+	return nil
+}
+
+// recordWrite snapshot the database after a query, which may have committed a write. A
+// committed write is never reported as an error, so if the copy fails the state is copied by
+// the next query or bookmark instead. h.mu must be held.
+func (m *MockClient) recordWrite(ctx context.Context, dbID string, db *sql.DB, h *history) {
+	m.snapshot(ctx, dbID, db, h)
+}
+
+// trim discard the oldest points beyond historyLimit. h.mu must be held.
+func (m *MockClient) trim(h *history) {
+	if len(h.points) <= historyLimit {
+		return
+	}
+	kept := h.points[len(h.points)-historyLimit:]
+	for _, p := range h.points[:len(h.points)-historyLimit] {
+		// restored points share the copy of the point they restored
+		if !slices.ContainsFunc(kept, func(k point) bool { return k.path == p.path }) {
+			os.Remove(p.path)
+		}
+	}
+	h.points = slices.Clone(kept)
+}
+
+// latest bookmark of the current state of a database. h.mu must be held.
+func (h *history) latest(dbID string) string {
+	return bookmark(dbID, h.points[len(h.points)-1].version)
+}
+
+// GetBookmark return the bookmark of the current state of the local sqlite db
+func (m *MockClient) GetBookmark(ctx context.Context, dbID string) (*utils.APIResponse[cloudflared1.Bookmark], error) {
+	db, h, ok := m.lock(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	defer h.mu.Unlock()
+	// copy a state whose snapshot failed when it was written
+	if err := m.snapshot(ctx, dbID, db, h); err != nil {
+		return nil, err
+	}
+	return &utils.APIResponse[cloudflared1.Bookmark]{
+		Result:  cloudflared1.Bookmark{Bookmark: h.latest(dbID)},
+		Success: true,
+		Errors:  nil,
+	}, nil
+}
+
+// GetBookmarkAt return the bookmark of the local sqlite db as it was at at
+func (m *MockClient) GetBookmarkAt(_ context.Context, dbID string, at time.Time) (*utils.APIResponse[cloudflared1.Bookmark], error) {
+	h, ok := m.historyOf(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i, ok := h.at(at)
+	if !ok {
+		return failedTimeTravel[cloudflared1.Bookmark](at), nil
+	}
+	return &utils.APIResponse[cloudflared1.Bookmark]{
+		Result:  cloudflared1.Bookmark{Bookmark: bookmark(dbID, h.points[i].version)},
+		Success: true,
+		Errors:  nil,
+	}, nil
+}
+
+// RestoreBookmark replace the local sqlite db with its state at bookmark
+func (m *MockClient) RestoreBookmark(ctx context.Context, dbID string, bm string) (*utils.APIResponse[cloudflared1.RestoreResult], error) {
+	db, h, ok := m.lock(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	defer h.mu.Unlock()
+	for i, p := range h.points {
+		if bookmark(dbID, p.version) == bm {
+			return m.restore(ctx, dbID, db, h, i)
+		}
+	}
+	return &utils.APIResponse[cloudflared1.RestoreResult]{
+		Success: false,
+		Errors: []utils.D1Err{
+			{
+				Code:    7500,
+				Message: fmt.Sprintf("Invalid bookmark: %s", bm),
+			},
+		},
+	}, nil
+}
+
+// RestoreTimestamp replace the local sqlite db with its state at at
+func (m *MockClient) RestoreTimestamp(ctx context.Context, dbID string, at time.Time) (*utils.APIResponse[cloudflared1.RestoreResult], error) {
+	db, h, ok := m.lock(dbID)
+	if !ok {
+		return nil, errNotFound(dbID)
+	}
+	defer h.mu.Unlock()
+	i, ok := h.at(at)
+	if !ok {
+		return failedTimeTravel[cloudflared1.RestoreResult](at), nil
+	}
+	return m.restore(ctx, dbID, db, h, i)
+}
+
+// at return the index of the last point recorded at or before t
+func (h *history) at(t time.Time) (int, bool) {
+	for i := len(h.points) - 1; i >= 0; i-- {
+		if !h.points[i].at.After(t) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// restore replace the database with its state at point i. The restored state is recorded as a
+// new point so it has a bookmark of its own. h.mu must be held, so no query is using the
+// connection which is replaced.
+func (m *MockClient) restore(ctx context.Context, dbID string, db *sql.DB, h *history, i int) (*utils.APIResponse[cloudflared1.RestoreResult], error) {
+	// copy the current state, if its snapshot failed, so the restore can be undone
+	if err := m.snapshot(ctx, dbID, db, h); err != nil {
+		return nil, err
+	}
+	previous := h.latest(dbID)
+	target := h.points[i]
+	if err := m.replaceDB(dbID, target.path); err != nil {
+		return nil, err
+	}
+	counter, err := changeCounter(m.getDBPath(dbID))
+	if err != nil {
+		return nil, err
+	}
+	h.version++
+	h.counter = counter
+	h.points = append(h.points, point{version: h.version, at: time.Now(), path: target.path})
+	m.trim(h)
+
+	return &utils.APIResponse[cloudflared1.RestoreResult]{
+		Result: cloudflared1.RestoreResult{
+			Bookmark:         bookmark(dbID, target.version),
+			PreviousBookmark: previous,
+			Message:          "Restored database to bookmark",
+		},
+		Success: true,
+		Errors:  nil,
+	}, nil
+}
+
+// replaceDB close the connection to a database, overwrite its file with src and reopen it.
+// The history lock of the database must be held.
+func (m *MockClient) replaceDB(dbID string, src string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if conn, ok := m.conns[dbID]; ok {
+		conn.Close()
+	}
+	path := m.getDBPath(dbID)
+	if err := copyFile(src, path); err != nil {
+		return err
+	}
+	db, err := openDB(path)
+	if err != nil {
+		return err
+	}
+	m.conns[dbID] = db
+	return nil
+}
+
+// failedTimeTravel response when no snapshot exists at or before at
+func failedTimeTravel[T any](at time.Time) *utils.APIResponse[T] {
+	return &utils.APIResponse[T]{
+		Success: false,
+		Errors: []utils.D1Err{
+			{
+				Code:    7500,
+				Message: fmt.Sprintf("No bookmark found at or before %s", at.Format(time.RFC3339)),
+			},
+		},
+	}
+}
+
+// copyFile replace the contents of dst with src
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,61 @@
+package cloudflared1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrNoRows returned by QueryOne when the query produced no rows
+var ErrNoRows = errors.New("d1: no rows in result set")
+
+// Query execute a query on any CloudflareD1 implementation and scan each row into a T.
+//
+// If T is a struct, columns are mapped to fields by their `d1:"column"` tag, or by a case insensitive match
+// of the field name when untagged. Fields tagged `d1:"-"` are skipped, as are columns without a matching field.
+// Otherwise the query must return a single column, which is converted to T.
+//
+// Values are converted according to SQLite type affinity: integers decoded from JSON as float64 are
+// converted to integer fields, 0/1 to booleans, text to time.Time, and JSON text to structs, maps and slices.
+// If the query contains multiple statements, rows are read from the last one.
+func Query[T any](ctx context.Context, d1 CloudflareD1, dbID string, query string, params ...any) ([]T, Meta, error) {
+	res, err := d1.QueryDBRaw(ctx, dbID, query, params...)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, Meta{}, err
+	}
+	if len(res.Result) == 0 {
+		return nil, Meta{}, nil
+	}
+	raw := res.Result[len(res.Result)-1]
+	out := make([]T, 0, len(raw.Rows))
+	scanner, err := newRowScanner(reflect.TypeFor[T](), raw.Columns)
+	if err != nil {
+		return nil, raw.Meta, err
+	}
+	for i, row := range raw.Rows {
+		var item T
+		if err := scanner.scan(reflect.ValueOf(&item).Elem(), row); err != nil {
+			return nil, raw.Meta, fmt.Errorf("d1: row %d: %w", i, err)
+		}
+		out = append(out, item)
+	}
+	return out, raw.Meta, nil
+}
+
+// QueryOne execute a query and scan the first row into a T, as described for Query.
+// ErrNoRows is returned if the query produced no rows.
+func QueryOne[T any](ctx context.Context, d1 CloudflareD1, dbID string, query string, params ...any) (T, Meta, error) {
+	var zero T
+	items, meta, err := Query[T](ctx, d1, dbID, query, params...)
+	if err != nil {
+		return zero, meta, err
+	}
+	if len(items) == 0 {
+		return zero, meta, ErrNoRows
+	}
+	return items[0], meta, nil
+}
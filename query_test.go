@@ -0,0 +1,120 @@
+package cloudflared1_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	cloudflared1 "github.com/crosleyzack/cloudflare-d1-go"
+	"github.com/crosleyzack/cloudflare-d1-go/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+type base struct {
+	ID int64 `d1:"id"`
+}
+
+type user struct {
+	base
+	Name      string            `d1:"name"`
+	Verified  bool              `d1:"verified"`
+	Age       *int              `d1:"age"`
+	Score     float64           `d1:"score"`
+	CreatedAt time.Time         `d1:"created_at"`
+	Settings  map[string]string `d1:"settings"`
+	Nickname  sql.NullString    `d1:"nickname"`
+	Ignored   string            `d1:"-"`
+	Email     string
+}
+
+func newTestDB(t *testing.T) (*mock.MockClient, string) {
+	client, err := mock.NewMockClient(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	ctx := context.Background()
+	res, err := client.CreateDB(ctx, "query")
+	assert.NoError(t, err)
+	dbID := res.Result.UUID.String()
+	batch, err := client.BatchQuery(ctx, dbID, []cloudflared1.Statement{
+		{SQL: `CREATE TABLE users (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			verified INTEGER DEFAULT 0,
+			age INTEGER,
+			score REAL,
+			created_at TEXT,
+			settings TEXT,
+			nickname TEXT,
+			email TEXT
+		)`},
+		{SQL: `INSERT INTO users (name, verified, age, score, created_at, settings, nickname, email) VALUES
+			('alice', 1, 30, 1.5, '2024-01-02 03:04:05', '{"theme":"dark"}', 'al', 'alice@example.com'),
+			('bob', 0, NULL, 2, '2024-02-03T04:05:06Z', '{}', NULL, 'bob@example.com')`},
+	})
+	assert.NoError(t, err)
+	assert.True(t, batch.Success)
+	return client, dbID
+}
+
+func TestQuery(t *testing.T) {
+	client, dbID := newTestDB(t)
+	ctx := context.Background()
+
+	users, meta, err := cloudflared1.Query[user](ctx, client, dbID, "SELECT * FROM users ORDER BY id")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, meta.RowsRead)
+	assert.Len(t, users, 2)
+
+	alice := users[0]
+	assert.EqualValues(t, 1, alice.ID)
+	assert.Equal(t, "alice", alice.Name)
+	assert.True(t, alice.Verified)
+	assert.Equal(t, 30, *alice.Age)
+	assert.Equal(t, 1.5, alice.Score)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), alice.CreatedAt)
+	assert.Equal(t, map[string]string{"theme": "dark"}, alice.Settings)
+	assert.Equal(t, sql.NullString{String: "al", Valid: true}, alice.Nickname)
+	assert.Equal(t, "alice@example.com", alice.Email)
+
+	bob := users[1]
+	assert.False(t, bob.Verified)
+	assert.Nil(t, bob.Age)
+	assert.False(t, bob.Nickname.Valid)
+	assert.Equal(t, time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC), bob.CreatedAt)
+
+	// pointers to structs
+	ptrs, _, err := cloudflared1.Query[*user](ctx, client, dbID, "SELECT id, name FROM users WHERE verified = ?", 1)
+	assert.NoError(t, err)
+	assert.Len(t, ptrs, 1)
+	assert.Equal(t, "alice", ptrs[0].Name)
+
+	// single column into scalars
+	names, _, err := cloudflared1.Query[string](ctx, client, dbID, "SELECT name FROM users ORDER BY name DESC")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob", "alice"}, names)
+
+	// multiple columns cannot be scanned into a scalar
+	_, _, err = cloudflared1.Query[string](ctx, client, dbID, "SELECT id, name FROM users")
+	assert.Error(t, err)
+
+	// query errors are returned
+	_, _, err = cloudflared1.Query[user](ctx, client, dbID, "SELECT * FROM missing")
+	assert.Error(t, err)
+}
+
+func TestQueryOne(t *testing.T) {
+	client, dbID := newTestDB(t)
+	ctx := context.Background()
+
+	count, _, err := cloudflared1.QueryOne[int](ctx, client, dbID, "SELECT count(*) FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	u, _, err := cloudflared1.QueryOne[user](ctx, client, dbID, "SELECT * FROM users WHERE name = ?", "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", u.Name)
+
+	_, _, err = cloudflared1.QueryOne[user](ctx, client, dbID, "SELECT * FROM users WHERE name = ?", "carol")
+	assert.ErrorIs(t, err, cloudflared1.ErrNoRows)
+}
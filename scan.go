@@ -0,0 +1,310 @@
+package cloudflared1
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType    = reflect.TypeFor[time.Time]()
+	scannerType = reflect.TypeFor[sql.Scanner]()
+	bytesType   = reflect.TypeFor[[]byte]()
+)
+
+// timeFormats text formats SQLite and D1 commonly use to store timestamps
+var timeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// rowScanner maps the columns of a raw result onto a Go type
+type rowScanner struct {
+	// fields index path of the struct field for each column, nil when the column is not mapped
+	fields [][]int
+	// single the row has one column which is converted directly to the target type
+	single bool
+}
+
+// newRowScanner build a scanner for rows with the given columns into values of type t
+func newRowScanner(t reflect.Type, columns []string) (*rowScanner, error) {
+	base := t
+	if base.Kind() == reflect.Pointer {
+		base = base.Elem()
+	}
+	if base.Kind() != reflect.Struct || base == timeType || reflect.PointerTo(base).Implements(scannerType) {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("d1: cannot scan %d columns into %s", len(columns), t)
+		}
+		return &rowScanner{single: true}, nil
+	}
+	byName := map[string][]int{}
+	collectFields(base, nil, byName)
+	fields := make([][]int, len(columns))
+	for i, col := range columns {
+		fields[i] = byName[strings.ToLower(col)]
+	}
+	return &rowScanner{fields: fields}, nil
+}
+
+// collectFields map lower cased column names to the index path of exported fields,
+// flattening untagged embedded structs
+func collectFields(t reflect.Type, index []int, byName map[string][]int) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("d1"), ",")
+		if tag == "-" {
+			continue
+		}
+		path := append(append([]int{}, index...), i)
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			collectFields(field.Type, path, byName)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = field.Name
+		}
+		name = strings.ToLower(name)
+		if _, ok := byName[name]; !ok {
+			byName[name] = path
+		}
+	}
+}
+
+// scan convert a row of values into dst
+func (s *rowScanner) scan(dst reflect.Value, row []any) error {
+	if s.single {
+		return assign(dst, row[0])
+	}
+	if dst.Kind() == reflect.Pointer {
+		dst.Set(reflect.New(dst.Type().Elem()))
+		dst = dst.Elem()
+	}
+	for i, path := range s.fields {
+		if path == nil || i >= len(row) {
+			continue
+		}
+		field := dst.FieldByIndex(path)
+		if err := assign(field, row[i]); err != nil {
+			return fmt.Errorf("field %s: %w", dst.Type().FieldByIndex(path).Name, err)
+		}
+	}
+	return nil
+}
+
+// assign convert a value decoded from D1 into dst, following SQLite type affinity
+func assign(dst reflect.Value, src any) error {
+	if dst.CanAddr() && dst.Addr().Type().Implements(scannerType) {
+		return dst.Addr().Interface().(sql.Scanner).Scan(normalize(src))
+	}
+	if src == nil {
+		dst.SetZero()
+		return nil
+	}
+	if dst.Kind() == reflect.Pointer {
+		v := reflect.New(dst.Type().Elem())
+		if err := assign(v.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	}
+	if dst.Type() == timeType {
+		t, err := toTime(src)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if dst.Type() == bytesType {
+		b, err := toBytes(src)
+		if err != nil {
+			return err
+		}
+		dst.SetBytes(b)
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(src))
+	case reflect.String:
+		s, err := toString(src)
+		if err != nil {
+			return err
+		}
+		dst.SetString(s)
+	case reflect.Bool:
+		b, err := toBool(src)
+		if err != nil {
+			return err
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt(src)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, dst.Type())
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := toInt(src)
+		if err != nil {
+			return err
+		}
+		if n < 0 || dst.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %d overflows %s", n, dst.Type())
+		}
+		dst.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(src)
+		if err != nil {
+			return err
+		}
+		dst.SetFloat(f)
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		// JSON stored as text
+		s, ok := src.(string)
+		if !ok {
+			return fmt.Errorf("cannot convert %T to %s", src, dst.Type())
+		}
+		return json.Unmarshal([]byte(s), dst.Addr().Interface())
+	default:
+		return fmt.Errorf("unsupported destination type %s", dst.Type())
+	}
+	return nil
+}
+
+// normalize convert integral float64 values, as decoded from JSON, to int64 for sql.Scanner implementations
+func normalize(src any) any {
+	if f, ok := src.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return src
+}
+
+func toString(src any) (string, error) {
+	switch v := src.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	}
+	return "", fmt.Errorf("cannot convert %T to string", src)
+}
+
+func toBool(src any) (bool, error) {
+	switch v := src.(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	case int64:
+		return v != 0, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "1", "true", "t", "yes", "y", "on":
+			return true, nil
+		case "0", "false", "f", "no", "n", "off", "":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("cannot convert %v to bool", src)
+}
+
+func toInt(src any) (int64, error) {
+	switch v := src.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("cannot convert %v to an integer without losing precision", v)
+		}
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to an integer", src)
+}
+
+func toFloat(src any) (float64, error) {
+	switch v := src.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to a float", src)
+}
+
+// toTime parse text timestamps in common SQLite formats, or numbers as unix seconds
+func toTime(src any) (time.Time, error) {
+	switch v := src.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, format := range timeFormats {
+			if t, err := time.Parse(format, v); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as a time", v)
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to a time", src)
+}
+
+// toBytes convert blobs, which D1 encodes in JSON as arrays of numbers, and text to bytes
+func toBytes(src any) ([]byte, error) {
+	switch v := src.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case []any:
+		b := make([]byte, len(v))
+		for i, item := range v {
+			n, err := toInt(item)
+			if err != nil || n < 0 || n > math.MaxUint8 {
+				return nil, fmt.Errorf("cannot convert %v to a byte", item)
+			}
+			b[i] = byte(n)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to bytes", src)
+}
@@ -0,0 +1,37 @@
+package cloudflared1
+
+import (
+	"context"
+	"time"
+
+	"github.com/crosleyzack/cloudflare-d1-go/utils"
+)
+
+// TimeTraveler is implemented by clients supporting D1 Time Travel, which can return
+// a database to any point in its recent history.
+// https://developers.cloudflare.com/d1/reference/time-travel/
+type TimeTraveler interface {
+	// GetBookmark return the bookmark of the current state of the database
+	GetBookmark(ctx context.Context, dbID string) (*utils.APIResponse[Bookmark], error)
+	// GetBookmarkAt return the bookmark nearest to, but not after, the given time
+	GetBookmarkAt(ctx context.Context, dbID string, at time.Time) (*utils.APIResponse[Bookmark], error)
+	// RestoreBookmark restore the database to the state identified by bookmark
+	RestoreBookmark(ctx context.Context, dbID string, bookmark string) (*utils.APIResponse[RestoreResult], error)
+	// RestoreTimestamp restore the database to its state at the given time
+	RestoreTimestamp(ctx context.Context, dbID string, at time.Time) (*utils.APIResponse[RestoreResult], error)
+}
+
+// Bookmark identifies a point in the history of a database
+type Bookmark struct {
+	Bookmark string `json:"bookmark"`
+}
+
+// RestoreResult result of restoring a database to an earlier point in time.
+// Restore PreviousBookmark to undo the restore.
+type RestoreResult struct {
+	// Bookmark the database was restored to
+	Bookmark string `json:"bookmark"`
+	// PreviousBookmark state of the database immediately before the restore
+	PreviousBookmark string `json:"previous_bookmark"`
+	Message          string `json:"message"`
+}
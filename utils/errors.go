@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound the requested account, database or resource does not exist
+	ErrNotFound = errors.New("d1: not found")
+	// ErrUnauthorized the API token is missing, invalid or lacks permission
+	ErrUnauthorized = errors.New("d1: unauthorized")
+	// ErrRateLimited the cloudflare API rate limit was exceeded
+	ErrRateLimited = errors.New("d1: rate limited")
+	// ErrConstraint a SQL constraint, such as UNIQUE or NOT NULL, was violated
+	ErrConstraint = errors.New("d1: constraint violation")
+	// ErrOverloaded the D1 database has too many queued requests
+	ErrOverloaded = errors.New("d1: database overloaded")
+)
+
+const (
+	// maxErrorBody limit on how much of a non-JSON error body is kept
+	maxErrorBody = 512
+)
+
+// APIError a failed request to the cloudflare API.
+// Use errors.Is with ErrNotFound, ErrUnauthorized, ErrRateLimited, ErrConstraint or ErrOverloaded
+// to check for common failures, or errors.As to inspect the details.
+type APIError struct {
+	// StatusCode HTTP status of the response. Zero if the failure did not come from an HTTP response.
+	StatusCode int
+	// Errors cloudflare errors from the response envelope
+	Errors []D1Err
+	// Messages cloudflare messages from the response envelope
+	Messages []string
+	// RayID cloudflare ray ID of the request, useful for support tickets
+	RayID string
+	// RetryAfter delay requested by the server through the Retry-After header, if any
+	RetryAfter time.Duration
+	// Body start of the response body when it could not be decoded
+	Body string
+	// Err underlying decode error, if any
+	Err error
+}
+
+// NewAPIError create an error from a failed response envelope
+func NewAPIError(statusCode int, errs []D1Err, messages []string) *APIError {
+	return &APIError{
+		StatusCode: statusCode,
+		Errors:     errs,
+		Messages:   messages,
+	}
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	b.WriteString("d1: request failed")
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " with status %d", e.StatusCode)
+	}
+	for i, d1Err := range e.Errors {
+		if i == 0 {
+			b.WriteString(":")
+		} else {
+			b.WriteString(";")
+		}
+		fmt.Fprintf(&b, " [%d] %s", d1Err.Code, d1Err.Message)
+	}
+	if len(e.Errors) == 0 {
+		if e.Err != nil {
+			fmt.Fprintf(&b, ": %v", e.Err)
+		}
+		if e.Body != "" {
+			fmt.Fprintf(&b, ": %q", e.Body)
+		}
+	}
+	if e.RayID != "" {
+		fmt.Fprintf(&b, " (ray %s)", e.RayID)
+	}
+	return b.String()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is report whether the error matches one of the sentinel errors in this package
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.hasCode(7404) || e.hasMessage("not found")
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden ||
+			e.hasCode(10000) || e.hasCode(9109)
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests || e.hasCode(971)
+	case ErrConstraint:
+		return e.hasMessage("constraint failed") || e.hasMessage("sqlite_constraint")
+	case ErrOverloaded:
+		return e.hasMessage("overloaded")
+	}
+	return false
+}
+
+// hasCode check if any of the cloudflare errors has the given code
+func (e *APIError) hasCode(code int) bool {
+	for _, d1Err := range e.Errors {
+		if d1Err.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMessage check if any of the cloudflare errors contains the given text, ignoring case
+func (e *APIError) hasMessage(text string) bool {
+	for _, d1Err := range e.Errors {
+		if strings.Contains(strings.ToLower(d1Err.Message), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Err return an *APIError if the response was not successful, otherwise nil
+func (r *APIResponse[T]) Err() error {
+	if r == nil || r.Success {
+		return nil
+	}
+	return NewAPIError(0, r.Errors, r.Messages)
+}
@@ -0,0 +1,33 @@
+package utils
+
+import "io"
+
+// ProgressFunc receives the number of bytes transferred so far and the total expected,
+// which is -1 when unknown.
+type ProgressFunc func(done, total int64)
+
+// progressReader reports the bytes read through it to a ProgressFunc
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+// NewProgressReader wrap r so that progress is called after each read.
+// If progress is nil, r is returned unchanged.
+func NewProgressReader(r io.Reader, total int64, progress ProgressFunc) io.Reader {
+	if progress == nil {
+		return r
+	}
+	return &progressReader{r: r, total: total, progress: progress}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
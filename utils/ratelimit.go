@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter token bucket which limits the rate of requests to the cloudflare API,
+// along with an optional cap on the number of requests in flight.
+// It is safe for concurrent use and may be shared between clients using the same account.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// slots semaphore of in-flight requests, nil when unlimited
+	slots chan struct{}
+}
+
+// NewRateLimiter create a limiter allowing requestsPerSecond on average with bursts of up to burst requests,
+// and at most maxConcurrent requests in flight. A requestsPerSecond or maxConcurrent of zero disables that limit.
+// Cloudflare allows 1200 requests per 5 minutes per user, which is a rate of 4 requests per second.
+func NewRateLimiter(requestsPerSecond float64, burst int, maxConcurrent int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &RateLimiter{
+		rate:   requestsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// Acquire wait until a request may be sent, or ctx is done.
+// On success, release must be called once the request completes.
+func (l *RateLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release = func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait take a token from the bucket, sleeping until one is available
+func (l *RateLimiter) wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// reserve a token, going into debt if none are available
+	l.tokens--
+	delay := time.Duration(0)
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	if err := Sleep(ctx, delay); err != nil {
+		// return the unused reservation
+		l.mu.Lock()
+		l.tokens = math.Min(l.burst, l.tokens+1)
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterRate(t *testing.T) {
+	limiter := NewRateLimiter(100, 5, 0)
+	ctx := context.Background()
+	start := time.Now()
+	// the burst is available immediately, the remaining 5 take ~50ms
+	for range 10 {
+		release, err := limiter.Acquire(ctx)
+		assert.NoError(t, err)
+		release()
+	}
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 40*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+}
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	limiter := NewRateLimiter(0, 1, 2)
+	var inFlight, maxInFlight atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := limiter.Acquire(context.Background())
+			assert.NoError(t, err)
+			defer release()
+			n := inFlight.Add(1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			inFlight.Add(-1)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(2))
+}
+
+func TestRateLimiterContext(t *testing.T) {
+	limiter := NewRateLimiter(1, 1, 1)
+	release, err := limiter.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	// concurrency slot is held
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	release()
+
+	// no tokens remain for another second
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	var limiter *RateLimiter
+	release, err := limiter.Acquire(context.Background())
+	assert.NoError(t, err)
+	release()
+}
@@ -2,9 +2,12 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
+	"time"
 )
 
 type D1Err struct {
@@ -12,44 +15,146 @@ type D1Err struct {
 	Message string `json:"message"`
 }
 
+// ResultInfo pagination details of a list response
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+}
+
 type APIResponse[T any] struct {
-	Result   T        `json:"result"`
-	Success  bool     `json:"success"`
-	Messages []string `json:"messages"`
-	Errors   []D1Err  `json:"errors"`
+	Result     T           `json:"result"`
+	ResultInfo *ResultInfo `json:"result_info,omitempty"`
+	Success    bool        `json:"success"`
+	Messages   []string    `json:"messages"`
+	Errors     []D1Err     `json:"errors"`
 }
 
-func DoRequest[T any](method string, url string, payload map[string]any, apiToken string) (*APIResponse[T], error) {
-	var reqbody io.Reader
+// RequestConfig settings applied to each request sent by DoRequest
+type RequestConfig struct {
+	// HTTPClient used to send the request. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// APIToken sent as a bearer token
+	APIToken string
+	// UserAgent sent with the request, if not empty
+	UserAgent string
+	// Logger receives debug logs for each request, if not nil
+	Logger *slog.Logger
+	// ErrorOnFailure return an *APIError when the response has an error status or success is false.
+	// Otherwise these responses are returned for the caller to inspect.
+	ErrorOnFailure bool
+	// Retry policy for failed attempts. If nil, the request is attempted once.
+	Retry *RetryPolicy
+	// Idempotent the request may be retried safely without RetryPolicy.RetryWrites
+	Idempotent bool
+	// Limiter throttles each attempt, if not nil
+	Limiter *RateLimiter
+}
+
+// DoRequest send a request to the cloudflare API and decode the response.
+// The request is bound to ctx, so cancellation and deadlines abort it in flight.
+// A body which is not a cloudflare response envelope, such as an HTML error page, is returned as an *APIError.
+// Transient failures are retried according to cfg.Retry.
+func DoRequest[T any](ctx context.Context, cfg RequestConfig, method string, url string, payload map[string]any) (*APIResponse[T], error) {
+	var reqbody []byte
 	if payload != nil {
 		jsonString, err := json.Marshal(payload)
 		if err != nil {
 			return nil, err
 		}
-		reqbody = bytes.NewReader(jsonString)
+		reqbody = jsonString
+	}
+	for attempt := 1; ; attempt++ {
+		res, err := doAttempt[T](ctx, cfg, method, url, reqbody)
+		if err == nil {
+			return res, nil
+		}
+		if cfg.Retry.shouldRetry(attempt, cfg.Idempotent, err) {
+			delay := cfg.Retry.backoff(attempt, err)
+			if cfg.Logger != nil {
+				cfg.Logger.DebugContext(ctx, "d1 request retry", "method", method, "url", url, "attempt", attempt, "delay", delay, "error", err)
+			}
+			if sleepErr := Sleep(ctx, delay); sleepErr != nil {
+				return nil, sleepErr
+			}
+			continue
+		}
+		// failed responses which decoded are returned for inspection unless configured otherwise
+		if res != nil && !cfg.ErrorOnFailure {
+			return res, nil
+		}
+		return nil, err
+	}
+}
+
+// doAttempt send a single request. If the response decoded but reports a failure,
+// both the response and an *APIError are returned.
+func doAttempt[T any](ctx context.Context, cfg RequestConfig, method string, url string, payload []byte) (*APIResponse[T], error) {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var reqbody io.Reader
+	if payload != nil {
+		reqbody = bytes.NewReader(payload)
 	}
-	req, err := http.NewRequest(method, url, reqbody)
+	req, err := http.NewRequestWithContext(ctx, method, url, reqbody)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiToken)
+	req.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+	if cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", cfg.UserAgent)
+	}
+
+	release, err := cfg.Limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	res, err := http.DefaultClient.Do(req)
+	start := time.Now()
+	res, err := client.Do(req)
 	if err != nil {
+		if cfg.Logger != nil {
+			cfg.Logger.DebugContext(ctx, "d1 request failed", "method", method, "url", url, "error", err)
+		}
 		return nil, err
 	}
 	defer res.Body.Close()
+	if cfg.Logger != nil {
+		cfg.Logger.DebugContext(ctx, "d1 request", "method", method, "url", url, "status", res.StatusCode, "duration", time.Since(start))
+	}
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	rayID := res.Header.Get("Cf-Ray")
+	retryAfter := parseRetryAfter(res.Header.Get("Retry-After"))
 	var apiRes APIResponse[T]
 	if err := json.Unmarshal(body, &apiRes); err != nil {
-		return nil, err
+		if len(body) > maxErrorBody {
+			body = body[:maxErrorBody]
+		}
+		return nil, &APIError{
+			StatusCode: res.StatusCode,
+			RayID:      rayID,
+			RetryAfter: retryAfter,
+			Body:       string(body),
+			Err:        err,
+		}
+	}
+
+	if res.StatusCode >= http.StatusBadRequest || !apiRes.Success {
+		apiErr := NewAPIError(res.StatusCode, apiRes.Errors, apiRes.Messages)
+		apiErr.RayID = rayID
+		apiErr.RetryAfter = retryAfter
+		return &apiRes, apiErr
 	}
 
 	return &apiRes, nil
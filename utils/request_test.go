@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(t *testing.T, status int, body string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cf-Ray", "abc123-SJC")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestDoRequestNonJSONBody(t *testing.T) {
+	url := serve(t, http.StatusBadGateway, "<html>502 Bad Gateway</html>")
+	_, err := DoRequest[any](context.Background(), RequestConfig{}, "GET", url, nil)
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.Equal(t, "abc123-SJC", apiErr.RayID)
+	assert.Contains(t, apiErr.Body, "502 Bad Gateway")
+	assert.Contains(t, err.Error(), "status 502")
+}
+
+func TestDoRequestFailureResponse(t *testing.T) {
+	body := `{"result":null,"success":false,"errors":[{"code":7404,"message":"The database could not be found"}],"messages":[]}`
+	url := serve(t, http.StatusNotFound, body)
+
+	// failures are returned as responses by default
+	res, err := DoRequest[any](context.Background(), RequestConfig{}, "GET", url, nil)
+	assert.NoError(t, err)
+	assert.False(t, res.Success)
+	assert.ErrorIs(t, res.Err(), ErrNotFound)
+
+	// and as errors when requested
+	res, err = DoRequest[any](context.Background(), RequestConfig{ErrorOnFailure: true}, "GET", url, nil)
+	assert.Nil(t, res)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NotErrorIs(t, err, ErrUnauthorized)
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "abc123-SJC", apiErr.RayID)
+	assert.Equal(t, 7404, apiErr.Errors[0].Code)
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    *APIError
+		target error
+	}{
+		{"unauthorized status", &APIError{StatusCode: http.StatusUnauthorized}, ErrUnauthorized},
+		{"authentication code", NewAPIError(http.StatusForbidden, []D1Err{{Code: 10000, Message: "Authentication error"}}, nil), ErrUnauthorized},
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, ErrRateLimited},
+		{"constraint", NewAPIError(http.StatusBadRequest, []D1Err{{Code: 7500, Message: "UNIQUE constraint failed: users.id: SQLITE_CONSTRAINT"}}, nil), ErrConstraint},
+		{"overloaded", NewAPIError(http.StatusServiceUnavailable, []D1Err{{Code: 7500, Message: "D1 DB is overloaded. Too many requests queued."}}, nil), ErrOverloaded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.err, tt.target)
+		})
+	}
+}
+
+func TestResponseErr(t *testing.T) {
+	ok := &APIResponse[any]{Success: true}
+	assert.NoError(t, ok.Err())
+	failed := &APIResponse[any]{Errors: []D1Err{{Code: 1, Message: "boom"}}}
+	assert.EqualError(t, failed.Err(), "d1: request failed: [1] boom")
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Multiplier:     2,
+	}
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1, errors.New("reset")))
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2, errors.New("reset")))
+	assert.Equal(t, 300*time.Millisecond, policy.backoff(3, errors.New("reset")))
+	// Retry-After takes precedence, within MaxBackoff
+	assert.Equal(t, 250*time.Millisecond, policy.backoff(3, &APIError{RetryAfter: 250 * time.Millisecond}))
+	assert.Equal(t, 300*time.Millisecond, policy.backoff(1, &APIError{RetryAfter: 2 * time.Hour}))
+	// jitter stays within bounds
+	policy.Jitter = 0.5
+	for range 10 {
+		d := policy.backoff(1, errors.New("reset"))
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("invalid"))
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	assert.Greater(t, parseRetryAfter(future), 30*time.Second)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(errors.New("connection reset by peer")))
+	assert.True(t, IsRetryable(&APIError{StatusCode: http.StatusBadGateway}))
+	assert.True(t, IsRetryable(&APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, IsRetryable(&APIError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.False(t, IsRetryable(nil))
+}
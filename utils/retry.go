@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how DoRequest retries failed requests.
+// By default only idempotent requests are retried; set RetryWrites to retry every request.
+type RetryPolicy struct {
+	// MaxAttempts total number of attempts, including the first. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff upper bound on the delay between attempts, including delays asked for by Retry-After
+	MaxBackoff time.Duration
+	// Multiplier growth of the delay after each attempt
+	Multiplier float64
+	// Jitter fraction of each delay, between 0 and 1, which is randomized to spread out retries
+	Jitter float64
+	// RetryWrites retry requests which are not idempotent, such as writes and database creation
+	RetryWrites bool
+	// Retryable classify whether an error should be retried. If nil, IsRetryable is used.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy policy used by clients unless overridden
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// IsRetryable report whether an error is likely transient: network failures, rate limiting,
+// server errors and overloaded databases. Context cancellation is never retried.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		// transport failures such as connection resets
+		return true
+	}
+	if errors.Is(apiErr, ErrRateLimited) || errors.Is(apiErr, ErrOverloaded) {
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// shouldRetry check if a failed attempt should be retried under the policy
+func (p *RetryPolicy) shouldRetry(attempt int, idempotent bool, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || !(idempotent || p.RetryWrites) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff delay before the next attempt. A Retry-After from the server takes precedence,
+// but is still capped by MaxBackoff so a server cannot stall the client indefinitely.
+func (p *RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if p.MaxBackoff > 0 && apiErr.RetryAfter > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		return apiErr.RetryAfter
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// parseRetryAfter read a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Sleep wait for d or until ctx is done, returning the context error if it ends first
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"strings"
+)
+
+// SplitStatements split SQL text into individual statements on semicolons, the way SQLite
+// would. Semicolons inside string literals, quoted identifiers, comments and the
+// BEGIN...END body of CREATE TRIGGER statements do not end a statement.
+// Statements are returned without their terminating semicolon or surrounding whitespace,
+// and statements which are empty or only comments are dropped.
+func SplitStatements(sql string) []string {
+	out, tail, _ := scanStatements(sql)
+	if tail != "" {
+		out = append(out, tail)
+	}
+	return out
+}
+
+// IsComplete report whether sql holds at least one statement and ends with a complete one, terminated
+// by a semicolon outside any string, comment or trigger body, as sqlite3_complete does. Interactive
+// shells use it to decide whether to run the input or read another line.
+func IsComplete(sql string) bool {
+	out, tail, open := scanStatements(sql)
+	return len(out) > 0 && tail == "" && !open
+}
+
+// scanStatements split sql into the statements terminated by a semicolon, and the trailing
+// unterminated statement, if any. open reports the text ended inside a quote or block comment.
+func scanStatements(sql string) (out []string, tail string, open bool) {
+	s := splitter{}
+	start := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i, open = skipQuoted(sql, i, c)
+			s.tokens++
+		case c == '[':
+			i, open = skipQuoted(sql, i, ']')
+			s.tokens++
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+				open = true
+			}
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(sql) && isIdentPart(sql[j]) {
+				j++
+			}
+			s.keyword(strings.ToUpper(sql[i:j]))
+			i = j
+		case c == ';':
+			if s.inTrigger && !s.triggerDone {
+				i++
+				continue
+			}
+			if s.tokens > 0 {
+				out = append(out, strings.TrimSpace(sql[start:i]))
+			}
+			i++
+			start = i
+			s = splitter{}
+		default:
+			if c > ' ' {
+				s.tokens++
+			}
+			i++
+		}
+	}
+	if s.tokens > 0 {
+		tail = strings.TrimSpace(sql[start:])
+	}
+	return out, tail, open
+}
+
+// splitter state of the statement being scanned
+type splitter struct {
+	// tokens number of tokens seen in the statement
+	tokens int
+	// prefix leading keywords, used to recognise CREATE [TEMP] TRIGGER
+	prefix []string
+	// inTrigger the statement creates a trigger, so semicolons only end it after the body
+	inTrigger bool
+	// inBody BEGIN of the trigger body has been seen
+	inBody bool
+	// caseDepth nesting of CASE expressions in the trigger body, which also close with END
+	caseDepth int
+	// triggerDone the END closing the trigger body has been seen
+	triggerDone bool
+}
+
+func (s *splitter) keyword(word string) {
+	s.tokens++
+	if len(s.prefix) < 3 {
+		s.prefix = append(s.prefix, word)
+		switch {
+		case len(s.prefix) >= 2 && s.prefix[0] == "CREATE" && s.prefix[1] == "TRIGGER",
+			len(s.prefix) == 3 && s.prefix[0] == "CREATE" && (s.prefix[1] == "TEMP" || s.prefix[1] == "TEMPORARY") && s.prefix[2] == "TRIGGER":
+			s.inTrigger = true
+		}
+	}
+	if !s.inTrigger {
+		return
+	}
+	switch word {
+	case "BEGIN":
+		s.inBody = true
+	case "CASE":
+		if s.inBody {
+			s.caseDepth++
+		}
+	case "END":
+		if s.caseDepth > 0 {
+			s.caseDepth--
+		} else if s.inBody {
+			s.triggerDone = true
+		}
+	}
+}
+
+// skipQuoted return the index after the quoted section starting at i, closed by end, and whether
+// the text ended before the section was closed. A doubled closing quote is an escaped quote rather than the end.
+func skipQuoted(sql string, i int, end byte) (int, bool) {
+	for j := i + 1; j < len(sql); j++ {
+		if sql[j] != end {
+			continue
+		}
+		if end != ']' && j+1 < len(sql) && sql[j+1] == end {
+			j++
+			continue
+		}
+		return j + 1, false
+	}
+	return len(sql), true
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '$'
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}},
+		{"terminated", "SELECT 1;", []string{"SELECT 1"}},
+		{"multiple", "CREATE TABLE t (a);\nINSERT INTO t VALUES (1);\n  SELECT * FROM t ;", []string{"CREATE TABLE t (a)", "INSERT INTO t VALUES (1)", "SELECT * FROM t"}},
+		{"strings", `INSERT INTO t VALUES ('a;b', 'it''s; fine'); SELECT 2`, []string{`INSERT INTO t VALUES ('a;b', 'it''s; fine')`, "SELECT 2"}},
+		{"identifiers", `SELECT "a;b", [c;d], ` + "`e;f`" + ` FROM t; SELECT 3`, []string{`SELECT "a;b", [c;d], ` + "`e;f`" + ` FROM t`, "SELECT 3"}},
+		{"comments", "-- leading; comment\nSELECT 1; /* block; comment */ SELECT 2; -- trailing;", []string{"-- leading; comment\nSELECT 1", "/* block; comment */ SELECT 2"}},
+		{"empty", " ; ;\n-- only a comment\n", nil},
+		{"trigger", `CREATE TRIGGER log AFTER INSERT ON t BEGIN
+	INSERT INTO audit VALUES (new.a);
+	UPDATE counts SET n = CASE WHEN n IS NULL THEN 1 ELSE n + 1 END;
+END; SELECT 4`, []string{`CREATE TRIGGER log AFTER INSERT ON t BEGIN
+	INSERT INTO audit VALUES (new.a);
+	UPDATE counts SET n = CASE WHEN n IS NULL THEN 1 ELSE n + 1 END;
+END`, "SELECT 4"}},
+		{"temp trigger", "CREATE TEMP TRIGGER x AFTER DELETE ON t BEGIN DELETE FROM u; END; SELECT 5", []string{"CREATE TEMP TRIGGER x AFTER DELETE ON t BEGIN DELETE FROM u; END", "SELECT 5"}},
+		{"begin transaction", "BEGIN; SELECT 1; END;", []string{"BEGIN", "SELECT 1", "END"}},
+		{"unterminated string", "SELECT 'abc; def", []string{"SELECT 'abc; def"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SplitStatements(tt.sql))
+		})
+	}
+}
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SELECT 1;", true},
+		{"SELECT 1", false},
+		{"SELECT 1;\n  ", true},
+		{"SELECT 1; -- done", true},
+		{"SELECT 1; SELECT", false},
+		{"SELECT 'a;", false},
+		{"SELECT \"a;\";", true},
+		{"SELECT 1; /* open;", false},
+		{"CREATE TRIGGER x AFTER INSERT ON t BEGIN DELETE FROM u;", false},
+		{"CREATE TRIGGER x AFTER INSERT ON t BEGIN DELETE FROM u; END;", true},
+		{";", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsComplete(tt.sql), tt.sql)
+	}
+}